@@ -0,0 +1,280 @@
+package traefik_maintenance_warden
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasicAuthConfig configures bypassing maintenance with HTTP Basic credentials
+type BasicAuthConfig struct {
+	// HtpasswdFile is an htpasswd file with {SHA}, {SSHA256} or $apr1$ entries, reloaded when it changes
+	HtpasswdFile string `json:"htpasswdFile,omitempty"`
+
+	// Realm is the realm announced in the WWW-Authenticate challenge
+	Realm string `json:"realm,omitempty"`
+
+	// LoginPath is a path answering with a WWW-Authenticate challenge so browsers prompt for
+	// credentials. Once logged in, the browser is redirected to the site root.
+	LoginPath string `json:"loginPath,omitempty"`
+}
+
+// htpasswdStore holds the parsed htpasswd entries and reloads them when the file changes
+type htpasswdStore struct {
+	path      string
+	entries   map[string]string
+	lastMod   time.Time
+	lastError string
+	mutex     sync.RWMutex
+}
+
+// newHtpasswdStore loads the htpasswd file
+func newHtpasswdStore(path string) (*htpasswdStore, error) {
+	store := &htpasswdStore{path: path}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load reads the htpasswd file if it changed since it was last loaded.
+// On error the previously loaded entries are kept.
+func (s *htpasswdStore) load() error {
+	fileInfo, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("error accessing htpasswd file: %w", err)
+	}
+
+	s.mutex.RLock()
+	unchanged := s.entries != nil && !fileInfo.ModTime().After(s.lastMod)
+	s.mutex.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("error reading htpasswd file: %w", err)
+	}
+
+	entries, err := parseHtpasswd(content)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.entries = entries
+	s.lastMod = fileInfo.ModTime()
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// recordError remembers the outcome of the last reload, reporting whether err is a failure
+// different from the previous one
+func (s *htpasswdStore) recordError(err error) bool {
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := message != "" && message != s.lastError
+	s.lastError = message
+	return changed
+}
+
+// parseHtpasswd parses "user:hash" lines, rejecting hash formats that can't be verified
+func parseHtpasswd(content []byte) (map[string]string, error) {
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" || hash == "" {
+			return nil, fmt.Errorf("invalid htpasswd entry on line %d", lineNumber)
+		}
+
+		if !strings.HasPrefix(hash, "{SHA}") && !strings.HasPrefix(hash, "{SSHA256}") && !strings.HasPrefix(hash, "$apr1$") {
+			return nil, fmt.Errorf("unsupported htpasswd hash for user %q on line %d, use {SHA}, {SSHA256} or $apr1$", user, lineNumber)
+		}
+
+		entries[user] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading htpasswd file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// verify checks the credentials against the loaded entries
+func (s *htpasswdStore) verify(user, password string) bool {
+	s.mutex.RLock()
+	hash, ok := s.entries[user]
+	s.mutex.RUnlock()
+
+	if !ok {
+		return false
+	}
+	return verifyHtpasswdHash(hash, password)
+}
+
+// verifyHtpasswdHash checks a password against a {SHA}, {SSHA256} or $apr1$ hash
+func verifyHtpasswdHash(hash, password string) bool {
+	var computed string
+
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		digest := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(digest[:])
+	case strings.HasPrefix(hash, "{SSHA256}"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hash, "{SSHA256}"))
+		if err != nil || len(decoded) <= sha256.Size {
+			return false
+		}
+		salt := decoded[sha256.Size:]
+		digest := sha256.Sum256(append([]byte(password), salt...))
+		computed = "{SSHA256}" + base64.StdEncoding.EncodeToString(append(digest[:], salt...))
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1Hash(password, salt)
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1Hash computes the Apache variant of the MD5-crypt password hash
+func apr1Hash(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic))
+	ctx.Write([]byte(salt))
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			ctx.Write(altSum)
+		} else {
+			ctx.Write(altSum[:i])
+		}
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+
+	final := ctx.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var encoded strings.Builder
+	to64 := func(value uint32, n int) {
+		for ; n > 0; n-- {
+			encoded.WriteByte(itoa64[value&0x3f])
+			value >>= 6
+		}
+	}
+
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(final[group[0]])<<16|uint32(final[group[1]])<<8|uint32(final[group[2]]), 4)
+	}
+	to64(uint32(final[11]), 2)
+
+	return magic + salt + "$" + encoded.String()
+}
+
+// matchBasicAuthBypass reports whether the request carries valid Basic credentials, returning the user
+func (m *MaintenanceBypass) matchBasicAuthBypass(req *http.Request) (string, bool) {
+	if m.htpasswd == nil {
+		return "", false
+	}
+
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false
+	}
+
+	// A failure that persists is logged once rather than on every request carrying credentials
+	err := m.htpasswd.load()
+	if m.htpasswd.recordError(err) {
+		m.logRequest(req, LogLevelError, "Failed to reload htpasswd file, keeping previous entries: %v", err)
+	}
+
+	if !m.htpasswd.verify(user, password) {
+		m.recordBypassFailure(req, "basic auth")
+		return "", false
+	}
+
+	return user, true
+}
+
+// serveBasicAuthChallenge answers the login path. Authenticated browsers are sent to the site root,
+// everyone else gets a WWW-Authenticate challenge.
+func (m *MaintenanceBypass) serveBasicAuthChallenge(rw http.ResponseWriter, req *http.Request, authenticated bool) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	if authenticated {
+		http.Redirect(rw, req, "/", http.StatusFound)
+		return
+	}
+
+	rw.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", m.basicAuth.Realm))
+	rw.Header().Set("X-Maintenance-Mode", "true")
+	http.Error(rw, "Authentication required", http.StatusUnauthorized)
+}
@@ -0,0 +1,212 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestApr1Hash tests the APR1 implementation against hashes produced by htpasswd
+func TestApr1Hash(t *testing.T) {
+	testCases := []struct {
+		password string
+		salt     string
+		expected string
+	}{
+		{"myPassword", "r31.....", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"},
+		{"password", "saltsalt", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"},
+	}
+
+	for _, tc := range testCases {
+		if hash := apr1Hash(tc.password, tc.salt); hash != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, hash)
+		}
+	}
+}
+
+// TestVerifyHtpasswdHash tests the supported hash formats
+func TestVerifyHtpasswdHash(t *testing.T) {
+	shaDigest := sha1.Sum([]byte("secret"))
+	shaHash := "{SHA}" + base64.StdEncoding.EncodeToString(shaDigest[:])
+
+	salt := []byte("pepper")
+	sshaDigest := sha256.Sum256(append([]byte("secret"), salt...))
+	sshaHash := "{SSHA256}" + base64.StdEncoding.EncodeToString(append(sshaDigest[:], salt...))
+
+	testCases := []struct {
+		name     string
+		hash     string
+		password string
+		expected bool
+	}{
+		{"SHA match", shaHash, "secret", true},
+		{"SHA mismatch", shaHash, "Secret", false},
+		{"Salted SHA256 match", sshaHash, "secret", true},
+		{"Salted SHA256 mismatch", sshaHash, "secrets", false},
+		{"APR1 match", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/", "password", true},
+		{"APR1 mismatch", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/", "passw0rd", false},
+		{"Bcrypt is not supported", "$2y$05$abcdefghijklmnopqrstuv", "secret", false},
+		{"Truncated salted SHA256", "{SSHA256}c2hvcnQ=", "secret", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := verifyHtpasswdHash(tc.hash, tc.password); result != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+// TestBasicAuthBypass tests bypassing with Basic credentials, the login challenge and hot reloading
+func TestBasicAuthBypass(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-htpasswd")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	htpasswdPath := filepath.Join(tmpDir, "htpasswd")
+	content := "# maintenance staff\nalice:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n"
+	if err := ioutil.WriteFile(htpasswdPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write htpasswd file: %v", err)
+	}
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+		BasicAuthBypass: BasicAuthConfig{
+			HtpasswdFile: htpasswdPath,
+			LoginPath:    "/maintenance-login",
+		},
+		LogLevel: int(LogLevelError),
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	serve := func(path, user, password string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	if resp := serve("/", "alice", "password"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected valid credentials to bypass, got %d", resp.StatusCode)
+	}
+
+	if resp := serve("/", "alice", "wrong"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected wrong password to get the maintenance page, got %d", resp.StatusCode)
+	}
+
+	if resp := serve("/", "", ""); resp.Header.Get("WWW-Authenticate") != "" {
+		t.Errorf("Expected no challenge outside the login path")
+	}
+
+	resp := serve("/maintenance-login", "", "")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), `Basic realm="Maintenance"`) {
+		t.Errorf("Expected challenge on login path, got %d %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	resp = serve("/maintenance-login", "alice", "password")
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+		t.Errorf("Expected redirect to / after login, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// Replace the file and make sure it is seen as modified
+	content = "bob:{SHA}" + base64.StdEncoding.EncodeToString(func() []byte { d := sha1.Sum([]byte("builder")); return d[:] }()) + "\n"
+	if err := ioutil.WriteFile(htpasswdPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write htpasswd file: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(htpasswdPath, future, future)
+
+	if resp := serve("/", "bob", "builder"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected reloaded credentials to bypass, got %d", resp.StatusCode)
+	}
+
+	if resp := serve("/", "alice", "password"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected removed user to be rejected, got %d", resp.StatusCode)
+	}
+
+	// A broken file keeps the last good entries and is logged once
+	logBuffer := &testLogWriter{}
+	middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+	if err := ioutil.WriteFile(htpasswdPath, []byte("carol:$2y$05$bcrypt\n"), 0644); err != nil {
+		t.Fatalf("Failed to write htpasswd file: %v", err)
+	}
+	future = future.Add(time.Minute)
+	os.Chtimes(htpasswdPath, future, future)
+
+	for i := 0; i < 3; i++ {
+		if resp := serve("/", "bob", "builder"); resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected last good credentials to be kept, got %d", resp.StatusCode)
+		}
+	}
+	if count := strings.Count(logBuffer.String(), "Failed to reload htpasswd file"); count != 1 {
+		t.Errorf("Expected the reload failure to be logged once, got %d times", count)
+	}
+}
+
+// TestBasicAuthBypassValidation tests that invalid Basic auth configurations are rejected
+func TestBasicAuthBypassValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-htpasswd")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bcryptPath := filepath.Join(tmpDir, "bcrypt")
+	ioutil.WriteFile(bcryptPath, []byte("alice:$2y$05$abcdefghijklmnopqrstuv\n"), 0644)
+
+	malformedPath := filepath.Join(tmpDir, "malformed")
+	ioutil.WriteFile(malformedPath, []byte("alice\n"), 0644)
+
+	testCases := []struct {
+		name   string
+		config BasicAuthConfig
+	}{
+		{"Missing file", BasicAuthConfig{HtpasswdFile: "/nonexistent/htpasswd"}},
+		{"Unsupported bcrypt entry", BasicAuthConfig{HtpasswdFile: bcryptPath}},
+		{"Malformed entry", BasicAuthConfig{HtpasswdFile: malformedPath}},
+		{"Login path without file", BasicAuthConfig{LoginPath: "/login"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Enabled:            true,
+				BasicAuthBypass:    tc.config,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
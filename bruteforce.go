@@ -0,0 +1,119 @@
+package traefik_maintenance_warden
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// failureRecord tracks the failed bypass attempts of a single client IP
+type failureRecord struct {
+	ip          string
+	failures    int
+	windowStart time.Time
+	bannedUntil time.Time
+}
+
+// failureTracker counts failed bypass attempts per client IP and bans clients that exceed the
+// limit. Records are kept in a bounded LRU so guessing from many addresses can't exhaust memory.
+type failureTracker struct {
+	mutex       sync.Mutex
+	maxFailures int
+	window      time.Duration
+	banDuration time.Duration
+	maxClients  int
+	records     map[string]*list.Element
+	lru         *list.List
+}
+
+// newFailureTracker creates a tracker banning a client after maxFailures failures within window
+func newFailureTracker(maxFailures int, window, banDuration time.Duration, maxClients int) *failureTracker {
+	return &failureTracker{
+		maxFailures: maxFailures,
+		window:      window,
+		banDuration: banDuration,
+		maxClients:  maxClients,
+		records:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// isBanned reports whether the client is currently banned, forgetting expired records
+func (f *failureTracker) isBanned(ip string, now time.Time) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	element, ok := f.records[ip]
+	if !ok {
+		return false
+	}
+
+	record := element.Value.(*failureRecord)
+	if now.Before(record.bannedUntil) {
+		return true
+	}
+
+	if !record.bannedUntil.IsZero() || now.Sub(record.windowStart) >= f.window {
+		f.lru.Remove(element)
+		delete(f.records, ip)
+	}
+	return false
+}
+
+// recordFailure counts a failed attempt and returns true when it causes the client to be banned
+func (f *failureTracker) recordFailure(ip string, now time.Time) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var record *failureRecord
+	if element, ok := f.records[ip]; ok {
+		f.lru.MoveToFront(element)
+		record = element.Value.(*failureRecord)
+	} else {
+		if f.lru.Len() >= f.maxClients {
+			oldest := f.lru.Back()
+			f.lru.Remove(oldest)
+			delete(f.records, oldest.Value.(*failureRecord).ip)
+		}
+		record = &failureRecord{ip: ip, windowStart: now}
+		f.records[ip] = f.lru.PushFront(record)
+	}
+
+	if now.Before(record.bannedUntil) {
+		return false
+	}
+
+	if !record.bannedUntil.IsZero() || now.Sub(record.windowStart) >= f.window {
+		record.failures = 0
+		record.windowStart = now
+		record.bannedUntil = time.Time{}
+	}
+
+	record.failures++
+	if record.failures >= f.maxFailures {
+		record.bannedUntil = now.Add(f.banDuration)
+		return true
+	}
+	return false
+}
+
+// isBypassBanned reports whether the client has been banned from bypassing maintenance
+func (m *MaintenanceBypass) isBypassBanned(ip string) bool {
+	return m.failureTracker != nil && m.failureTracker.isBanned(ip, time.Now())
+}
+
+// recordBypassFailure records a failed bypass attempt, banning the client once it exceeds the limit
+func (m *MaintenanceBypass) recordBypassFailure(req *http.Request, mechanism string) {
+	ip := clientIP(req)
+	m.logRequest(req, LogLevelDebug, "Failed %s bypass attempt from %s", mechanism, ip)
+
+	if m.failureTracker == nil {
+		return
+	}
+
+	if m.failureTracker.recordFailure(ip, time.Now()) {
+		m.logRequest(req, LogLevelError, "Banning %s from bypassing maintenance for %v after %d failed attempts",
+			ip, m.failureTracker.banDuration, m.failureTracker.maxFailures)
+	}
+}
@@ -0,0 +1,129 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFailureTracker tests counting failures within a window, banning and expiry
+func TestFailureTracker(t *testing.T) {
+	tracker := newFailureTracker(3, time.Minute, 10*time.Minute, 100)
+	now := time.Now()
+
+	if tracker.recordFailure("192.0.2.1", now) || tracker.recordFailure("192.0.2.1", now.Add(time.Second)) {
+		t.Fatalf("Expected no ban before reaching the limit")
+	}
+
+	// Failures outside the window start a new count
+	if tracker.recordFailure("192.0.2.1", now.Add(2*time.Minute)) {
+		t.Fatalf("Expected failures outside the window to be forgotten")
+	}
+
+	tracker.recordFailure("192.0.2.1", now.Add(2*time.Minute+time.Second))
+	if !tracker.recordFailure("192.0.2.1", now.Add(2*time.Minute+2*time.Second)) {
+		t.Fatalf("Expected ban after 3 failures within the window")
+	}
+
+	if !tracker.isBanned("192.0.2.1", now.Add(5*time.Minute)) {
+		t.Errorf("Expected client to be banned during the ban duration")
+	}
+
+	if tracker.isBanned("192.0.2.2", now.Add(5*time.Minute)) {
+		t.Errorf("Expected other clients not to be banned")
+	}
+
+	if tracker.isBanned("192.0.2.1", now.Add(13*time.Minute)) {
+		t.Errorf("Expected ban to expire")
+	}
+
+	if len(tracker.records) != 0 {
+		t.Errorf("Expected expired record to be removed, got %d records", len(tracker.records))
+	}
+}
+
+// TestFailureTrackerBounded tests that the number of tracked clients is bounded
+func TestFailureTrackerBounded(t *testing.T) {
+	tracker := newFailureTracker(5, time.Minute, time.Minute, 2)
+	now := time.Now()
+
+	tracker.recordFailure("192.0.2.1", now)
+	tracker.recordFailure("192.0.2.2", now)
+	tracker.recordFailure("192.0.2.3", now)
+
+	if tracker.lru.Len() != 2 || len(tracker.records) != 2 {
+		t.Fatalf("Expected 2 tracked clients, got %d", len(tracker.records))
+	}
+
+	if _, ok := tracker.records["192.0.2.1"]; ok {
+		t.Errorf("Expected oldest client to be evicted")
+	}
+}
+
+// TestBypassBruteForceBan tests that guessing the bypass header bans the client from every bypass
+func TestBypassBruteForceBan(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "secret",
+		BypassPaths:        []string{"/health"},
+		BypassMaxFailures:  3,
+		Enabled:            true,
+		LogLevel:           int(LogLevelError),
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+
+	serve := func(remoteAddr, path, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+		req.RemoteAddr = remoteAddr
+		if value != "" {
+			req.Header.Set("X-Maintenance-Bypass", value)
+		}
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+		return recorder.Result().StatusCode
+	}
+
+	// Requests without the header are not failures
+	for i := 0; i < 5; i++ {
+		serve("192.0.2.1:1234", "/", "")
+	}
+	if status := serve("192.0.2.1:1234", "/", "secret"); status != http.StatusOK {
+		t.Fatalf("Expected bypass without prior failures, got %d", status)
+	}
+
+	for i := 0; i < 3; i++ {
+		serve("192.0.2.1:1234", "/", "guess")
+	}
+
+	if !strings.Contains(logBuffer.String(), "Banning 192.0.2.1") {
+		t.Errorf("Expected ban to be logged at error level, got %q", logBuffer.String())
+	}
+
+	if status := serve("192.0.2.1:1234", "/", "secret"); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected banned client to be refused the bypass header, got %d", status)
+	}
+
+	if status := serve("192.0.2.1:1234", "/health", ""); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected banned client to be refused bypass paths, got %d", status)
+	}
+
+	if status := serve("192.0.2.2:1234", "/", "secret"); status != http.StatusOK {
+		t.Errorf("Expected other clients to keep bypassing, got %d", status)
+	}
+}
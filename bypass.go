@@ -0,0 +1,136 @@
+package traefik_maintenance_warden
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// BypassValue is an accepted bypass header value. Exactly one of Value, ValueFile or ValueEnv must be set.
+type BypassValue struct {
+	// Label identifies the value in logs, e.g. the team it was issued to
+	Label string `json:"label,omitempty"`
+
+	// Value is the accepted header value
+	Value string `json:"value,omitempty"`
+
+	// ValueFile is a file holding the accepted header value, read once at startup
+	ValueFile string `json:"valueFile,omitempty"`
+
+	// ValueEnv is an environment variable holding the accepted header value
+	ValueEnv string `json:"valueEnv,omitempty"`
+}
+
+// bypassSecret is an accepted bypass value stored as a digest so that comparisons run in
+// constant time regardless of the length of the value sent by the client
+type bypassSecret struct {
+	label  string
+	digest [sha256.Size]byte
+}
+
+// resolve returns the secret value from its configured source
+func (v BypassValue) resolve() (string, error) {
+	sources := 0
+	for _, source := range []string{v.Value, v.ValueFile, v.ValueEnv} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return "", fmt.Errorf("exactly one of value, valueFile or valueEnv must be set")
+	}
+
+	switch {
+	case v.ValueFile != "":
+		content, err := ioutil.ReadFile(v.ValueFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading bypass value file: %w", err)
+		}
+		value := strings.TrimSpace(string(content))
+		if value == "" {
+			return "", fmt.Errorf("bypass value file is empty: %s", v.ValueFile)
+		}
+		return value, nil
+	case v.ValueEnv != "":
+		value := strings.TrimSpace(os.Getenv(v.ValueEnv))
+		if value == "" {
+			return "", fmt.Errorf("bypass value environment variable %s is not set", v.ValueEnv)
+		}
+		return value, nil
+	default:
+		return v.Value, nil
+	}
+}
+
+// loadBypassSecrets collects the accepted bypass header values from the configuration.
+// Values that can't be read from their file or environment variable are recorded on v.
+func loadBypassSecrets(v *configValidator, config *Config) []bypassSecret {
+	var secrets []bypassSecret
+
+	if config.BypassHeaderValue != "" {
+		secrets = append(secrets, bypassSecret{
+			label:  "default",
+			digest: sha256.Sum256([]byte(config.BypassHeaderValue)),
+		})
+	}
+
+	for i, value := range config.BypassHeaderValues {
+		label := value.Label
+		if label == "" {
+			label = fmt.Sprintf("value-%d", i)
+		}
+
+		secret, err := value.resolve()
+		if err != nil {
+			field := fmt.Sprintf("bypassHeaderValues[%d].valueEnv", i)
+			if value.ValueFile != "" {
+				field = fmt.Sprintf("bypassHeaderValues[%d].valueFile", i)
+			}
+			v.check(field, err)
+			continue
+		}
+
+		secrets = append(secrets, bypassSecret{
+			label:  label,
+			digest: sha256.Sum256([]byte(secret)),
+		})
+	}
+
+	return secrets
+}
+
+// matchBypassValue checks a value against the accepted bypass values in constant time,
+// returning the index of the matching secret
+func (m *MaintenanceBypass) matchBypassValue(value string) (int, bool) {
+	if value == "" {
+		return -1, false
+	}
+
+	digest := sha256.Sum256([]byte(value))
+	matched := -1
+	for i := range m.bypassSecrets {
+		if subtle.ConstantTimeCompare(digest[:], m.bypassSecrets[i].digest[:]) == 1 && matched < 0 {
+			matched = i
+		}
+	}
+
+	return matched, matched >= 0
+}
+
+// matchBypassHeader checks the bypass header against every accepted value and returns the label
+// of the matching one. All values are compared so the time taken doesn't reveal which one matched.
+func (m *MaintenanceBypass) matchBypassHeader(req *http.Request) (string, bool) {
+	if m.bypassHeader == "" {
+		return "", false
+	}
+
+	index, ok := m.matchBypassValue(req.Header.Get(m.bypassHeader))
+	if !ok {
+		return "", false
+	}
+	return m.bypassSecrets[index].label, true
+}
@@ -0,0 +1,152 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBypassHeaderValues tests accepting several labelled bypass values from different sources
+func TestBypassHeaderValues(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-bypass")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	secretFile := filepath.Join(tmpDir, "bypass-secret")
+	if err := ioutil.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	t.Setenv("MAINTENANCE_BYPASS_TEST_SECRET", "env-secret")
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "legacy-secret",
+		BypassHeaderValues: []BypassValue{
+			{Label: "payments-team", Value: "payments-secret"},
+			{Label: "platform-team", ValueFile: secretFile},
+			{Label: "ci", ValueEnv: "MAINTENANCE_BYPASS_TEST_SECRET"},
+		},
+		Enabled: true,
+		// Successful bypasses are recorded with their label without debug logging
+		LogLevel: int(LogLevelInfo),
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+
+	testCases := []struct {
+		name           string
+		value          string
+		expectedStatus int
+		expectedLabel  string
+	}{
+		{"Legacy value", "legacy-secret", http.StatusOK, "default"},
+		{"Inline value", "payments-secret", http.StatusOK, "payments-team"},
+		{"Value from file is trimmed", "file-secret", http.StatusOK, "platform-team"},
+		{"Value from environment", "env-secret", http.StatusOK, "ci"},
+		{"Wrong value", "payments-secre", http.StatusServiceUnavailable, ""},
+		{"Missing header", "", http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logBuffer.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tc.value != "" {
+				req.Header.Set("X-Maintenance-Bypass", tc.value)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Result().StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, recorder.Result().StatusCode)
+			}
+
+			if tc.expectedLabel != "" && !strings.Contains(logBuffer.String(), `"`+tc.expectedLabel+`"`) {
+				t.Errorf("Expected log to name label %q, got %q", tc.expectedLabel, logBuffer.String())
+			}
+
+			// Secrets must never be logged
+			if tc.value != "" && strings.Contains(logBuffer.String(), tc.value) {
+				t.Errorf("Expected bypass value not to be logged, got %q", logBuffer.String())
+			}
+		})
+	}
+}
+
+// TestEmptyBypassHeaderNeverBypasses tests that an unset bypass header name doesn't let every request through
+func TestEmptyBypassHeaderNeverBypasses(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if recorder.Result().StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, recorder.Result().StatusCode)
+	}
+}
+
+// TestBypassHeaderValuesValidation tests that misconfigured bypass values are rejected
+func TestBypassHeaderValuesValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name  string
+		value BypassValue
+	}{
+		{"No source", BypassValue{Label: "empty"}},
+		{"Several sources", BypassValue{Value: "secret", ValueEnv: "HOME"}},
+		{"Missing file", BypassValue{ValueFile: "/nonexistent/bypass-secret"}},
+		{"Unset environment variable", BypassValue{ValueEnv: "MAINTENANCE_BYPASS_TEST_UNSET"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				BypassHeader:       "X-Maintenance-Bypass",
+				BypassHeaderValues: []BypassValue{tc.value},
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsulStateConfig watches a Consul KV key holding the maintenance state with blocking queries.
+// The key holds a MaintenanceState JSON object or a boolean.
+type ConsulStateConfig struct {
+	// Address is the URL of the Consul HTTP API, e.g. "http://127.0.0.1:8500". The source is enabled when it is set.
+	Address string `json:"address,omitempty"`
+
+	// Key is the KV key holding the maintenance state
+	Key string `json:"key,omitempty"`
+
+	// Token is the ACL token sent with every request
+	Token string `json:"token,omitempty"`
+
+	// Datacenter queries a datacenter other than the agent's
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// WaitTime is how long a blocking query waits for a change, in seconds. Defaults to 300.
+	WaitTime int `json:"waitTime,omitempty"`
+}
+
+// consulState keeps the maintenance state in sync with a Consul KV key. It long-polls the key,
+// applying every change immediately, and keeps the last known state while Consul is unavailable.
+type consulState struct {
+	endpoint    *url.URL
+	config      ConsulStateConfig
+	wait        time.Duration
+	client      *http.Client
+	minInterval time.Duration
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+
+	// synced is set once the key has been read, so the state found at startup isn't notified
+	synced bool
+}
+
+// newConsulState validates the configuration and applies the defaults
+func newConsulState(config ConsulStateConfig) (*consulState, error) {
+	address, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+	if address.Scheme != "http" && address.Scheme != "https" || address.Host == "" {
+		return nil, fmt.Errorf("address must be an http or https URL, got %q", config.Address)
+	}
+
+	key := strings.Trim(config.Key, "/")
+	if key == "" {
+		return nil, fmt.Errorf("key must be set")
+	}
+
+	if config.WaitTime < 0 {
+		return nil, fmt.Errorf("wait time must not be negative")
+	}
+	wait := time.Duration(config.WaitTime) * time.Second
+	if wait == 0 {
+		wait = 5 * time.Minute
+	}
+
+	endpoint := *address
+	endpoint.Path = strings.TrimSuffix(address.Path, "/") + "/v1/kv/" + key
+
+	return &consulState{
+		endpoint: &endpoint,
+		config:   config,
+		wait:     wait,
+		// Consul adds up to wait/16 of jitter to blocking queries
+		client:      &http.Client{Timeout: wait + wait/16 + 10*time.Second},
+		minInterval: time.Second,
+		minBackoff:  time.Second,
+		maxBackoff:  time.Minute,
+	}, nil
+}
+
+// nextConsulIndex returns the index of the next blocking query. An index going backwards means
+// the key was recreated or the cluster state restored, so the watch starts over; an index of
+// zero would make every query return immediately.
+func nextConsulIndex(previous, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	if current == 0 {
+		return 1
+	}
+	return current
+}
+
+// run keeps the middleware's state in sync until the context is cancelled
+func (s *consulState) run(ctx context.Context, m *MaintenanceBypass) {
+	var index uint64
+	backoff := s.minBackoff
+
+	for {
+		start := time.Now()
+		current, err := s.fetch(ctx, m, index)
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := s.minInterval - time.Since(start)
+		if err != nil {
+			m.log(LogLevelError, "Consul state source %s unavailable, keeping last known state, retrying in %v: %v",
+				s.endpoint.Host, backoff, err)
+			delay = backoff
+			backoff *= 2
+			if backoff > s.maxBackoff {
+				backoff = s.maxBackoff
+			}
+		} else {
+			backoff = s.minBackoff
+			index = nextConsulIndex(index, current)
+		}
+
+		// Blocking queries may return early without a change, so don't poll faster than the minimum interval
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// fetch runs a blocking query for changes after index, applies the key and returns the new index
+func (s *consulState) fetch(ctx context.Context, m *MaintenanceBypass, index uint64) (uint64, error) {
+	query := url.Values{}
+	query.Set("raw", "true")
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(s.wait.Seconds())))
+	}
+	if s.config.Datacenter != "" {
+		query.Set("dc", s.config.Datacenter)
+	}
+
+	endpoint := *s.endpoint
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if s.config.Token != "" {
+		req.Header.Set("X-Consul-Token", s.config.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return 0, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	current, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("missing or invalid X-Consul-Index header %q", resp.Header.Get("X-Consul-Index"))
+	}
+
+	baseline := !s.synced
+	s.synced = true
+
+	if resp.StatusCode == http.StatusNotFound {
+		m.log(LogLevelDebug, "Consul state key %s is not set, keeping current state", s.config.Key)
+		return current, nil
+	}
+
+	state, err := parseMaintenanceState(body)
+	if err != nil {
+		m.log(LogLevelError, "Ignoring Consul state key %s: %v", s.config.Key, err)
+		return current, nil
+	}
+
+	m.applyState(state, "Consul key "+s.config.Key, baseline)
+	return current, nil
+}
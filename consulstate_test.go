@@ -0,0 +1,227 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConsulServer is a stand-in for the Consul KV API implementing blocking queries on one key
+type testConsulServer struct {
+	mutex   sync.Mutex
+	token   string
+	index   uint64
+	value   *string
+	changed chan struct{}
+	indexes []string
+}
+
+func newTestConsulServer(token string) *testConsulServer {
+	return &testConsulServer{token: token, index: 1, changed: make(chan struct{})}
+}
+
+func (s *testConsulServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/v1/kv/service/maintenance" || req.URL.Query().Get("raw") != "true" {
+		http.NotFound(rw, req)
+		return
+	}
+	if req.Header.Get("X-Consul-Token") != s.token {
+		http.Error(rw, "ACL not found", http.StatusForbidden)
+		return
+	}
+
+	s.mutex.Lock()
+	s.indexes = append(s.indexes, req.URL.Query().Get("index"))
+	index, _ := strconv.ParseUint(req.URL.Query().Get("index"), 10, 64)
+	changed := s.changed
+	current := s.index
+	s.mutex.Unlock()
+
+	// Block until the key changes past the client's index or the wait time elapses
+	if index > 0 && index >= current {
+		wait, err := time.ParseDuration(req.URL.Query().Get("wait"))
+		if err != nil {
+			wait = 5 * time.Minute
+		}
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rw.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	if s.value == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	rw.Write([]byte(*s.value))
+}
+
+// set changes the key, moving the index to the given value and waking blocked queries
+func (s *testConsulServer) set(value string, index uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.value = &value
+	s.index = index
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// requestedIndexes returns the index parameter of every query received so far
+func (s *testConsulServer) requestedIndexes() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.indexes...)
+}
+
+// TestConsulState tests applying changes from blocking queries and recovering from an index reset
+func TestConsulState(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	consul := newTestConsulServer("acl-token")
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	source, err := newConsulState(ConsulStateConfig{Address: server.URL, Key: "/service/maintenance", Token: "acl-token", WaitTime: 1})
+	if err != nil {
+		t.Fatalf("Error creating source: %v", err)
+	}
+	source.minInterval = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source.run(ctx, middleware.(*MaintenanceBypass))
+
+	// A missing key keeps the configured state
+	waitForStatus(t, middleware, http.StatusServiceUnavailable)
+
+	// Changes are applied as soon as the blocking query returns
+	consul.set(`{"enabled":false,"updatedBy":"ops"}`, 10)
+	waitForStatus(t, middleware, http.StatusOK)
+
+	consul.set("true", 11)
+	waitForStatus(t, middleware, http.StatusServiceUnavailable)
+
+	// An index going backwards restarts the watch without an index
+	consul.set("false", 3)
+	waitForStatus(t, middleware, http.StatusOK)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		indexes := consul.requestedIndexes()
+		if len(indexes) >= 2 && indexes[len(indexes)-2] == "" && indexes[len(indexes)-1] == "3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the watch to restart after the index reset, got indexes %q", indexes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestConsulStateToken tests that ACL errors are reported and the current state is kept
+func TestConsulStateToken(t *testing.T) {
+	consul := newTestConsulServer("acl-token")
+	consul.set("false", 5)
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	source, err := newConsulState(ConsulStateConfig{Address: server.URL, Key: "service/maintenance", Token: "wrong-token"})
+	if err != nil {
+		t.Fatalf("Error creating source: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	m := &MaintenanceBypass{enabled: true, logLevel: LogLevelError}
+	m.logger = log.New(logBuffer, "", 0)
+
+	if _, err := source.fetch(context.Background(), m, 0); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected ACL error, got %v", err)
+	}
+	if !m.isEnabled() {
+		t.Errorf("Expected current state to be kept")
+	}
+
+	source.config.Token = "acl-token"
+	index, err := source.fetch(context.Background(), m, 0)
+	if err != nil {
+		t.Fatalf("Expected fetch to succeed with the right token, got %v", err)
+	}
+	if index != 5 || m.isEnabled() {
+		t.Errorf("Expected index 5 and maintenance disabled, got index %d and enabled %v", index, m.isEnabled())
+	}
+}
+
+// TestNextConsulIndex tests the index reset rules for blocking queries
+func TestNextConsulIndex(t *testing.T) {
+	testCases := []struct {
+		name     string
+		previous uint64
+		current  uint64
+		expected uint64
+	}{
+		{"Index moves forward", 5, 8, 8},
+		{"Index unchanged", 8, 8, 8},
+		{"Index goes backwards", 8, 3, 0},
+		{"Index is zero", 0, 0, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if next := nextConsulIndex(tc.previous, tc.current); next != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, next)
+			}
+		})
+	}
+}
+
+// TestConsulStateValidation tests that misconfigured sources are rejected
+func TestConsulStateValidation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config ConsulStateConfig
+	}{
+		{"Address without scheme", ConsulStateConfig{Address: "127.0.0.1:8500", Key: "maintenance"}},
+		{"Missing key", ConsulStateConfig{Address: "http://127.0.0.1:8500"}},
+		{"Negative wait time", ConsulStateConfig{Address: "http://127.0.0.1:8500", Key: "maintenance", WaitTime: -1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				ConsulState:        tc.config,
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
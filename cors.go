@@ -0,0 +1,136 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig makes maintenance responses readable by single page applications served from other
+// origins. CORS handling is enabled when AllowedOrigins is set.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins allowed to read maintenance responses, or "*" for any origin
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+
+	// AllowedMethods is announced in preflight responses. Defaults to the common HTTP methods.
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+
+	// AllowedHeaders is announced in preflight responses. Defaults to the headers the browser asked for.
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+
+	// AllowCredentials lets browsers send cookies and read the response of credentialed requests
+	AllowCredentials bool `json:"allowCredentials,omitempty"`
+
+	// MaxAge is how long browsers may cache a preflight response, in seconds
+	MaxAge int `json:"maxAge,omitempty"`
+}
+
+// defaultCORSMethods are announced in preflight responses when no methods are configured
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// corsExposedHeaders are the maintenance headers scripts on other origins may read
+const corsExposedHeaders = "Retry-After, X-Maintenance-Mode"
+
+// validate checks the CORS configuration
+func (c CORSConfig) validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "" {
+			return fmt.Errorf("allowed origin must not be empty")
+		}
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			return fmt.Errorf("allowed origin %q must be \"*\" or start with http:// or https://", origin)
+		}
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max age must not be negative")
+	}
+	return nil
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for the request, or "" when
+// the origin isn't allowed. Credentialed responses can't use "*", so the origin is echoed.
+func (m *MaintenanceBypass) allowedOrigin(req *http.Request) string {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return ""
+	}
+
+	for _, allowed := range m.cors.AllowedOrigins {
+		if allowed == "*" {
+			if m.cors.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// isPreflightRequest reports whether the request is a CORS preflight
+func isPreflightRequest(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// applyCORSHeaders adds the CORS headers to a maintenance response
+func (m *MaintenanceBypass) applyCORSHeaders(rw http.ResponseWriter, req *http.Request) {
+	if len(m.cors.AllowedOrigins) == 0 {
+		return
+	}
+
+	rw.Header().Add("Vary", "Origin")
+
+	origin := m.allowedOrigin(req)
+	if origin == "" {
+		return
+	}
+
+	rw.Header().Set("Access-Control-Allow-Origin", origin)
+	rw.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+	if m.cors.AllowCredentials {
+		rw.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handlePreflight answers CORS preflight requests for resources under maintenance, so the browser
+// goes on to send the actual request and can read the maintenance response.
+// It returns true when a response has been written.
+func (m *MaintenanceBypass) handlePreflight(rw http.ResponseWriter, req *http.Request) bool {
+	if len(m.cors.AllowedOrigins) == 0 || !isPreflightRequest(req) {
+		return false
+	}
+
+	m.applyCORSHeaders(rw, req)
+	if m.allowedOrigin(req) == "" {
+		m.logRequest(req, LogLevelDebug, "CORS preflight from disallowed origin %s", req.Header.Get("Origin"))
+		rw.WriteHeader(http.StatusForbidden)
+		return true
+	}
+
+	methods := m.cors.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	rw.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if len(m.cors.AllowedHeaders) > 0 {
+		rw.Header().Set("Access-Control-Allow-Headers", strings.Join(m.cors.AllowedHeaders, ", "))
+	} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		rw.Header().Set("Access-Control-Allow-Headers", requested)
+	}
+
+	if m.cors.MaxAge > 0 {
+		rw.Header().Set("Access-Control-Max-Age", strconv.Itoa(m.cors.MaxAge))
+	}
+
+	rw.Header().Set("X-Maintenance-Mode", "true")
+	rw.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,167 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCORSPreflight tests answering preflights for resources under maintenance
+func TestCORSPreflight(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent: `{"maintenance":true}`,
+		ContentType:        "application/json",
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"https://app.example.com"},
+			MaxAge:         600,
+		},
+		Enabled: true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		origin          string
+		expectedStatus  int
+		expectedOrigin  string
+		expectedHeaders string
+	}{
+		{"Allowed origin", "https://app.example.com", http.StatusNoContent, "https://app.example.com", "Content-Type, X-Requested-With"},
+		{"Disallowed origin", "https://evil.example.com", http.StatusForbidden, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "http://api.example.com/orders", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "Content-Type, X-Requested-With")
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, recorder.Code)
+			}
+
+			if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != tc.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tc.expectedOrigin, origin)
+			}
+
+			if headers := recorder.Header().Get("Access-Control-Allow-Headers"); headers != tc.expectedHeaders {
+				t.Errorf("Expected Access-Control-Allow-Headers %q, got %q", tc.expectedHeaders, headers)
+			}
+
+			if tc.expectedStatus == http.StatusNoContent {
+				if recorder.Header().Get("Access-Control-Allow-Methods") == "" || recorder.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("Expected allowed methods and max age, got %v", recorder.Header())
+				}
+			}
+
+			if recorder.Body.Len() != 0 {
+				t.Errorf("Expected empty body, got %q", recorder.Body.String())
+			}
+		})
+	}
+}
+
+// TestCORSMaintenanceResponse tests that other origins can read the maintenance response
+func TestCORSMaintenanceResponse(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name                string
+		cors                CORSConfig
+		origin              string
+		expectedOrigin      string
+		expectedCredentials string
+	}{
+		{"Wildcard origin", CORSConfig{AllowedOrigins: []string{"*"}}, "https://app.example.com", "*", ""},
+		{"Wildcard with credentials echoes the origin", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://app.example.com", "https://app.example.com", "true"},
+		{"Listed origin", CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}, "https://APP.example.com", "https://APP.example.com", ""},
+		{"Unlisted origin", CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}, "https://other.example.com", "", ""},
+		{"Same origin request", CORSConfig{AllowedOrigins: []string{"*"}}, "", "", ""},
+		{"CORS disabled", CORSConfig{}, "https://app.example.com", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: `{"maintenance":true}`,
+				ContentType:        "application/json",
+				CORS:               tc.cors,
+				Enabled:            true,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://api.example.com/orders", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+			}
+
+			if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != tc.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tc.expectedOrigin, origin)
+			}
+
+			if credentials := recorder.Header().Get("Access-Control-Allow-Credentials"); credentials != tc.expectedCredentials {
+				t.Errorf("Expected Access-Control-Allow-Credentials %q, got %q", tc.expectedCredentials, credentials)
+			}
+
+			if tc.expectedOrigin != "" && recorder.Header().Get("Access-Control-Expose-Headers") != corsExposedHeaders {
+				t.Errorf("Expected maintenance headers to be exposed, got %q", recorder.Header().Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
+
+// TestCORSValidation tests that misconfigured CORS settings are rejected
+func TestCORSValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name string
+		cors CORSConfig
+	}{
+		{"Empty origin", CORSConfig{AllowedOrigins: []string{""}}},
+		{"Origin without scheme", CORSConfig{AllowedOrigins: []string{"app.example.com"}}},
+		{"Negative max age", CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: -1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				CORS:               tc.cors,
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package traefik_maintenance_warden
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultPageConfig customizes the built-in page served when no content source is configured
+type DefaultPageConfig struct {
+	// Title is the page heading, "Down for maintenance" by default
+	Title string `json:"title,omitempty"`
+
+	// Message explains the maintenance to visitors
+	Message string `json:"message,omitempty"`
+
+	// ContactURL is a link visitors can follow for help, e.g. a mailto: or status page URL
+	ContactURL string `json:"contactURL,omitempty"`
+
+	// ContactText is the text of the contact link, "Contact us" by default
+	ContactText string `json:"contactText,omitempty"`
+
+	// LogoURL is the URL of a logo shown above the title
+	LogoURL string `json:"logoURL,omitempty"`
+}
+
+// defaultPageTemplate is the built-in maintenance page. It is self-contained so it renders even
+// when every other asset of the site is unavailable.
+var defaultPageTemplate = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;font-family:system-ui,-apple-system,"Segoe UI",Roboto,sans-serif;line-height:1.5;color:#1f2933;background:#f5f7fa}
+main{box-sizing:border-box;width:100%;max-width:36rem;padding:2rem 1.5rem;text-align:center}
+img{max-width:12rem;max-height:6rem;margin-bottom:1.5rem}
+h1{font-size:1.75rem;margin:0 0 1rem}
+p{margin:0 0 1rem}
+a{color:#0b5cad}
+a:focus{outline:3px solid #0b5cad;outline-offset:2px}
+.reference{font-size:.875rem;color:#52606d}
+@media (prefers-color-scheme:dark){body{color:#e4e7eb;background:#1f2933}a{color:#7cc4fa}a:focus{outline-color:#7cc4fa}.reference{color:#9aa5b1}}
+</style>
+</head>
+<body>
+<main>
+{{if .LogoURL}}<img src="{{.LogoURL}}" alt="">
+{{end}}<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .EndTime}}<p>We expect to be back by <time datetime="{{.EndTime}}">{{.EndTimeText}}</time>.</p>
+{{end}}{{if .ContactURL}}<p><a href="{{.ContactURL}}">{{.ContactText}}</a></p>
+{{end}}<p class="reference">Reference: {trace_id}</p>
+</main>
+</body>
+</html>
+`))
+
+// defaultPage is the built-in maintenance page, rendered once when the middleware is created
+type defaultPage struct {
+	config  DefaultPageConfig
+	endTime time.Time
+	html    []byte
+}
+
+// newDefaultPage applies the defaults, checks the links and renders the HTML page
+func newDefaultPage(config DefaultPageConfig, endTime time.Time) (*defaultPage, error) {
+	if config.Title == "" {
+		config.Title = "Down for maintenance"
+	}
+	if config.Message == "" {
+		config.Message = "We're performing scheduled maintenance and will be back shortly. Thank you for your patience."
+	}
+	if config.ContactText == "" {
+		config.ContactText = "Contact us"
+	}
+
+	if err := validatePageURL(config.ContactURL, "http", "https", "mailto", "tel"); err != nil {
+		return nil, fmt.Errorf("invalid contactURL: %w", err)
+	}
+	if err := validatePageURL(config.LogoURL, "http", "https"); err != nil {
+		return nil, fmt.Errorf("invalid logoURL: %w", err)
+	}
+
+	data := struct {
+		DefaultPageConfig
+		EndTime     string
+		EndTimeText string
+	}{DefaultPageConfig: config}
+	if !endTime.IsZero() {
+		data.EndTime = endTime.UTC().Format(time.RFC3339)
+		data.EndTimeText = endTime.UTC().Format("January 2, 2006 at 15:04 UTC")
+	}
+
+	var html bytes.Buffer
+	if err := defaultPageTemplate.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render default page: %w", err)
+	}
+
+	return &defaultPage{config: config, endTime: endTime, html: html.Bytes()}, nil
+}
+
+// validatePageURL checks that an optional link uses one of the allowed schemes.
+// Root-relative paths are allowed so the logo can be served by a bypassed path.
+func validatePageURL(value string, schemes ...string) error {
+	if value == "" {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" && u.Host == "" && len(u.Path) > 0 && u.Path[0] == '/' {
+		return nil
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported URL %q", value)
+}
+
+// serveDefaultPage serves the built-in page, as JSON to API clients and as HTML to everyone else
+func (m *MaintenanceBypass) serveDefaultPage(rw http.ResponseWriter, req *http.Request) {
+	statusCode := m.maintenanceStatusCode(req)
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Header().Set("X-Maintenance-Mode", "true")
+
+	if m.isAPIRequest(req) {
+		body := map[string]interface{}{
+			"maintenance": true,
+			"status":      statusCode,
+			"title":       m.defaultPage.config.Title,
+			"message":     m.defaultPage.config.Message,
+			"retryAfter":  m.retryAfterSeconds(time.Now()),
+			"traceId":     traceIDFromRequest(req),
+		}
+		if m.defaultPage.config.ContactURL != "" {
+			body["contact"] = m.defaultPage.config.ContactURL
+		}
+		if m.defaultPage.config.LogoURL != "" {
+			body["logo"] = m.defaultPage.config.LogoURL
+		}
+		if !m.defaultPage.endTime.IsZero() {
+			body["endTime"] = m.defaultPage.endTime.UTC().Format(time.RFC3339)
+		}
+
+		content, _ := json.Marshal(body)
+		rw.Header().Set("Content-Type", "application/json")
+		writeMaintenanceBody(rw, req, statusCode, content)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writeMaintenanceBody(rw, req, statusCode, renderMaintenanceBody(req, m.defaultPage.html))
+}
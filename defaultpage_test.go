@@ -0,0 +1,147 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDefaultPage tests the built-in page served with just enabled: true
+func TestDefaultPage(t *testing.T) {
+	testCases := []struct {
+		name             string
+		config           DefaultPageConfig
+		expectedContains []string
+		unexpected       []string
+	}{
+		{
+			"Defaults",
+			DefaultPageConfig{},
+			[]string{"<title>Down for maintenance</title>", "scheduled maintenance", `name="viewport"`, `lang="en"`, "Reference: 4bf92f3577b34da6a3ce929d0e0e4736"},
+			[]string{"<img", "<a href"},
+		},
+		{
+			"Custom content",
+			DefaultPageConfig{
+				Title:       "Shop upgrade",
+				Message:     "Back in <10 minutes",
+				ContactURL:  "mailto:support@example.com",
+				ContactText: "Email support",
+				LogoURL:     "https://cdn.example.com/logo.svg",
+			},
+			[]string{"<h1>Shop upgrade</h1>", "Back in &lt;10 minutes", `<a href="mailto:support@example.com">Email support</a>`, `<img src="https://cdn.example.com/logo.svg" alt="">`},
+			[]string{"Back in <10"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{DefaultPage: tc.config, Enabled: true}
+
+			middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("traceparent", testTraceparent)
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+			}
+			if recorder.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+				t.Errorf("Expected HTML content type, got %q", recorder.Header().Get("Content-Type"))
+			}
+
+			body := recorder.Body.String()
+			for _, expected := range tc.expectedContains {
+				if !strings.Contains(body, expected) {
+					t.Errorf("Expected page to contain %q, got %q", expected, body)
+				}
+			}
+			for _, unexpected := range tc.unexpected {
+				if strings.Contains(body, unexpected) {
+					t.Errorf("Expected page not to contain %q", unexpected)
+				}
+			}
+		})
+	}
+}
+
+// TestDefaultPageJSON tests the JSON form of the built-in page served to API clients
+func TestDefaultPageJSON(t *testing.T) {
+	endTime := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg := &Config{
+		DefaultPage: DefaultPageConfig{
+			Title:      "Shop upgrade",
+			ContactURL: "https://status.example.com",
+		},
+		MaintenanceEndTime: endTime.Format(time.RFC3339),
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/orders", nil)
+	req.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", recorder.Header().Get("Content-Type"))
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON body, got %q", recorder.Body.String())
+	}
+
+	if body["maintenance"] != true || body["status"] != float64(http.StatusServiceUnavailable) || body["title"] != "Shop upgrade" {
+		t.Errorf("Expected maintenance status and title, got %v", body)
+	}
+	if body["contact"] != "https://status.example.com" || body["endTime"] != "2030-01-02T03:04:05Z" {
+		t.Errorf("Expected contact and end time, got %v", body)
+	}
+	if _, ok := body["logo"]; ok {
+		t.Errorf("Expected no logo, got %v", body["logo"])
+	}
+	if message, _ := body["message"].(string); message == "" {
+		t.Errorf("Expected default message, got %v", body["message"])
+	}
+}
+
+// TestDefaultPageValidation tests that unsafe links are rejected
+func TestDefaultPageValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  DefaultPageConfig
+		wantErr bool
+	}{
+		{"Relative logo path", DefaultPageConfig{LogoURL: "/assets/logo.png"}, false},
+		{"Telephone contact", DefaultPageConfig{ContactURL: "tel:+15555550100"}, false},
+		{"Script contact URL", DefaultPageConfig{ContactURL: "javascript:alert(1)"}, true},
+		{"Data logo URL", DefaultPageConfig{LogoURL: "data:image/svg+xml,<svg/>"}, true},
+		{"Mailto logo URL", DefaultPageConfig{LogoURL: "mailto:support@example.com"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(context.Background(), http.NotFoundHandler(), &Config{DefaultPage: tc.config, Enabled: true}, "maintenance-test")
+			if tc.wantErr && err == nil {
+				t.Errorf("Expected error but got none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Expected no error but got: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package traefik_maintenance_warden
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// drainMarkerCookieName is the cookie marking visitors seen before drain started
+const drainMarkerCookieName = "maintenance_seen"
+
+// drainMarkerMaxAge is how long browsers keep the drain marker
+const drainMarkerMaxAge = 30 * 24 * time.Hour
+
+// drainStarts remembers when drain mode started for each middleware name. Traefik rebuilds
+// middlewares on every dynamic configuration change, so the start time must outlive a single
+// MaintenanceBypass instance for the grace period not to restart on unrelated reloads.
+// drainKeys holds the random key signing the drain markers of each middleware name when no
+// DrainSecret is configured, so markers stay valid across reloads of the same process.
+// drainArmed records the names that issued drain markers while maintenance was off.
+var (
+	drainStarts      = map[string]time.Time{}
+	drainKeys        = map[string][]byte{}
+	drainArmed       = map[string]bool{}
+	drainStartsMutex sync.Mutex
+)
+
+// armDrain records that the named middleware issues drain markers ahead of maintenance
+func armDrain(name string) {
+	drainStartsMutex.Lock()
+	defer drainStartsMutex.Unlock()
+
+	drainArmed[name] = true
+}
+
+// drainPrepared reports whether visitors of the named middleware may carry drain markers:
+// drain mode was configured while maintenance was off, or a drain is already under way
+func drainPrepared(name string) bool {
+	drainStartsMutex.Lock()
+	defer drainStartsMutex.Unlock()
+
+	_, started := drainStarts[name]
+	return drainArmed[name] || started
+}
+
+// resolveDrainKey returns the key signing drain markers: the configured secret, or a random key
+// kept for the middleware name
+func resolveDrainKey(name string, secret string) []byte {
+	if secret != "" {
+		digest := sha256.Sum256([]byte(secret))
+		return digest[:]
+	}
+
+	drainStartsMutex.Lock()
+	defer drainStartsMutex.Unlock()
+
+	if key, ok := drainKeys[name]; ok {
+		return key
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	drainKeys[name] = key
+	return key
+}
+
+// resolveDrainStart returns the start of the drain period for the named middleware.
+// An explicit start time always wins; otherwise the first time drain was seen is kept.
+func resolveDrainStart(name string, configured string, now time.Time) (time.Time, error) {
+	drainStartsMutex.Lock()
+	defer drainStartsMutex.Unlock()
+
+	if configured != "" {
+		start, err := time.Parse(time.RFC3339, configured)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid drain start time %q: %w", configured, err)
+		}
+		drainStarts[name] = start
+		return start, nil
+	}
+
+	if start, ok := drainStarts[name]; ok {
+		return start, nil
+	}
+
+	drainStarts[name] = now
+	return now, nil
+}
+
+// forgetDrainStart clears the remembered drain start so the next drain gets a fresh grace period
+func forgetDrainStart(name string) {
+	drainStartsMutex.Lock()
+	defer drainStartsMutex.Unlock()
+
+	delete(drainStarts, name)
+}
+
+// updateDrainStart starts the drain period when maintenance is switched on and ends it when
+// maintenance is switched off. The caller must hold stateMutex.
+func (m *MaintenanceBypass) updateDrainStart(enabled bool, now time.Time) {
+	if !m.drainEnabled {
+		return
+	}
+
+	if !enabled {
+		forgetDrainStart(m.name)
+		m.drainStart = time.Time{}
+		return
+	}
+
+	// The configured start time has been validated with the rest of the configuration
+	m.drainStart, _ = resolveDrainStart(m.name, m.drainStartTime, now)
+}
+
+// signDrainMarker creates a drain marker value recording when the visitor was seen
+func signDrainMarker(key []byte, issued time.Time) string {
+	payload := strconv.FormatInt(issued.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDrainMarker checks a drain marker, returning when it was issued
+func verifyDrainMarker(key []byte, value string) (time.Time, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return time.Time{}, false
+	}
+
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0]))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return time.Time{}, false
+	}
+	return time.Unix(issued, 0), true
+}
+
+// drainMarkerIssued returns when the request's drain marker was issued, if it has a valid one
+func (m *MaintenanceBypass) drainMarkerIssued(req *http.Request) (time.Time, bool) {
+	cookie, err := req.Cookie(drainMarkerCookieName)
+	if err != nil || cookie.Value == "" {
+		return time.Time{}, false
+	}
+	return verifyDrainMarker(m.drainKey, cookie.Value)
+}
+
+// issueDrainMarker marks a visitor passing through while maintenance is off, so the session
+// they get from the backend can be recognised as existing once drain starts
+func (m *MaintenanceBypass) issueDrainMarker(rw http.ResponseWriter, req *http.Request) {
+	if m.drainKey == nil {
+		return
+	}
+	if _, ok := m.drainMarkerIssued(req); ok {
+		return
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     drainMarkerCookieName,
+		Value:    signDrainMarker(m.drainKey, time.Now()),
+		Path:     "/",
+		MaxAge:   int(drainMarkerMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// isDraining reports whether the request belongs to an existing session that may still pass
+// through during the drain grace period. A session cookie alone isn't enough, since anyone can
+// send one: the visitor must also carry a drain marker issued before drain started. Markers are
+// only issued while maintenance is off, so visitors arriving during maintenance never get one.
+func (m *MaintenanceBypass) isDraining(req *http.Request) bool {
+	if !m.drainEnabled {
+		return false
+	}
+
+	m.stateMutex.RLock()
+	drainStart := m.drainStart
+	m.stateMutex.RUnlock()
+
+	if drainStart.IsZero() || time.Since(drainStart) >= m.drainGracePeriod {
+		return false
+	}
+
+	issued, ok := m.drainMarkerIssued(req)
+	if !ok || issued.After(drainStart) {
+		return false
+	}
+
+	for _, name := range m.drainSessionCookies {
+		if cookie, err := req.Cookie(name); err == nil && cookie.Value != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,326 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestDrainMode tests that existing sessions pass through during the grace period only
+func TestDrainMode(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent:  "<html><body>Maintenance</body></html>",
+		BypassHeader:        "X-Maintenance-Bypass",
+		BypassHeaderValue:   "true",
+		Enabled:             true,
+		DrainMode:           true,
+		DrainSessionCookies: []string{"session", "cart"},
+		DrainGracePeriod:    60,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-drain-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+	defer forgetDrainStart("maintenance-drain-test")
+
+	m := middleware.(*MaintenanceBypass)
+
+	drainStart := time.Now()
+	beforeDrain := signDrainMarker(m.drainKey, drainStart.Add(-time.Hour))
+	afterDrain := signDrainMarker(m.drainKey, drainStart.Add(time.Hour))
+	forged := signDrainMarker([]byte("another key"), drainStart.Add(-time.Hour))
+
+	testCases := []struct {
+		name           string
+		cookie         *http.Cookie
+		marker         string
+		drainStart     time.Time
+		expectedStatus int
+	}{
+		{"Existing session passes during grace period", &http.Cookie{Name: "session", Value: "abc"}, beforeDrain, drainStart, http.StatusOK},
+		{"Any configured cookie identifies a session", &http.Cookie{Name: "cart", Value: "42"}, beforeDrain, drainStart, http.StatusOK},
+		{"New visitor is blocked right away", nil, "", drainStart, http.StatusServiceUnavailable},
+		{"Session cookie without a marker is blocked", &http.Cookie{Name: "session", Value: "anything"}, "", drainStart, http.StatusServiceUnavailable},
+		{"Marker issued after drain started is blocked", &http.Cookie{Name: "session", Value: "abc"}, afterDrain, drainStart, http.StatusServiceUnavailable},
+		{"Forged marker is blocked", &http.Cookie{Name: "session", Value: "abc"}, forged, drainStart, http.StatusServiceUnavailable},
+		{"Marker without a session is blocked", nil, beforeDrain, drainStart, http.StatusServiceUnavailable},
+		{"Unrelated cookie is blocked", &http.Cookie{Name: "theme", Value: "dark"}, beforeDrain, drainStart, http.StatusServiceUnavailable},
+		{"Existing session is blocked after grace period", &http.Cookie{Name: "session", Value: "abc"}, beforeDrain, drainStart.Add(-2 * time.Minute), http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m.drainStart = tc.drainStart
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/checkout", nil)
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			if tc.marker != "" {
+				req.AddCookie(&http.Cookie{Name: drainMarkerCookieName, Value: tc.marker})
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Result().StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, recorder.Result().StatusCode)
+			}
+		})
+	}
+}
+
+// TestDrainMarkerIssued tests that visitors get a drain marker while maintenance is off
+func TestDrainMarkerIssued(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent:  "<html><body>Maintenance</body></html>",
+		Enabled:             false,
+		DrainMode:           true,
+		DrainSessionCookies: []string{"session"},
+		DrainSecret:         "shared-drain-secret",
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-drain-marker-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+	defer forgetDrainStart("maintenance-drain-marker-test")
+
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != drainMarkerCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly drain marker cookie, got %v", cookies)
+	}
+
+	// Instances sharing the secret accept each other's markers
+	other, err := New(context.Background(), nextHandler, cfg, "maintenance-drain-marker-other")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+	if _, ok := verifyDrainMarker(other.(*MaintenanceBypass).drainKey, cookies[0].Value); !ok {
+		t.Errorf("Expected the marker to be valid for an instance sharing the secret")
+	}
+
+	// Visitors already carrying a valid marker keep it
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if len(recorder.Result().Cookies()) != 0 {
+		t.Errorf("Expected no new marker, got %v", recorder.Result().Cookies())
+	}
+}
+
+// TestDrainStartSurvivesReload tests that recreating the middleware keeps the original drain start
+func TestDrainStartSurvivesReload(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	name := "maintenance-drain-reload-test"
+	defer forgetDrainStart(name)
+
+	cfg := &Config{
+		MaintenanceContent:  "<html><body>Maintenance</body></html>",
+		Enabled:             true,
+		DrainMode:           true,
+		DrainSessionCookies: []string{"session"},
+	}
+
+	first, err := New(context.Background(), nextHandler, cfg, name)
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	second, err := New(context.Background(), nextHandler, cfg, name)
+	if err != nil {
+		t.Fatalf("Error recreating middleware: %v", err)
+	}
+
+	if !first.(*MaintenanceBypass).drainStart.Equal(second.(*MaintenanceBypass).drainStart) {
+		t.Errorf("Expected drain start to survive reload")
+	}
+
+	if second.(*MaintenanceBypass).drainGracePeriod != 15*time.Minute {
+		t.Errorf("Expected default grace period of 15 minutes, got %v", second.(*MaintenanceBypass).drainGracePeriod)
+	}
+
+	// Disabling drain forgets the start so the next drain gets a fresh grace period
+	cfg.DrainMode = false
+	if _, err := New(context.Background(), nextHandler, cfg, name); err != nil {
+		t.Fatalf("Error recreating middleware: %v", err)
+	}
+
+	drainStartsMutex.Lock()
+	_, remembered := drainStarts[name]
+	drainStartsMutex.Unlock()
+	if remembered {
+		t.Errorf("Expected drain start to be forgotten once drain mode is disabled")
+	}
+
+	// An explicit start time wins over the remembered one
+	cfg.DrainMode = true
+	cfg.DrainStartTime = "2026-01-02T15:04:05Z"
+	third, err := New(context.Background(), nextHandler, cfg, name)
+	if err != nil {
+		t.Fatalf("Error recreating middleware: %v", err)
+	}
+
+	expected, _ := time.Parse(time.RFC3339, cfg.DrainStartTime)
+	if !third.(*MaintenanceBypass).drainStart.Equal(expected) {
+		t.Errorf("Expected drain start %v, got %v", expected, third.(*MaintenanceBypass).drainStart)
+	}
+}
+
+// TestDrainStartsWhenEnabledAtRuntime tests that switching maintenance on starts the drain period
+func TestDrainStartsWhenEnabledAtRuntime(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	name := "maintenance-drain-runtime-test"
+	defer forgetDrainStart(name)
+
+	cfg := &Config{
+		MaintenanceContent:  "<html><body>Maintenance</body></html>",
+		Enabled:             false,
+		DrainMode:           true,
+		DrainSessionCookies: []string{"session"},
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, name)
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+	m := middleware.(*MaintenanceBypass)
+
+	// A visitor seen while maintenance is off gets a marker
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	marker := recorder.Result().Cookies()
+	if len(marker) != 1 {
+		t.Fatalf("Expected a drain marker, got %v", marker)
+	}
+
+	if err := m.SetEnabled(true); err != nil {
+		t.Fatalf("Error enabling maintenance: %v", err)
+	}
+	if m.drainStart.IsZero() || time.Since(m.drainStart) > time.Minute {
+		t.Fatalf("Expected the drain to start when maintenance is switched on, got %v", m.drainStart)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/checkout", nil)
+	req.AddCookie(marker[0])
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	recorder = httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected the existing session to pass during the grace period, got %d", recorder.Code)
+	}
+
+	// Switching maintenance off ends the drain, so the next one gets a fresh grace period
+	if err := m.SetEnabled(false); err != nil {
+		t.Fatalf("Error disabling maintenance: %v", err)
+	}
+	drainStartsMutex.Lock()
+	_, remembered := drainStarts[name]
+	drainStartsMutex.Unlock()
+	if remembered || !m.drainStart.IsZero() {
+		t.Errorf("Expected the drain start to be forgotten once maintenance is switched off")
+	}
+}
+
+// TestDrainPrepared tests that drain is known to be prepared once configured ahead of maintenance
+func TestDrainPrepared(t *testing.T) {
+	name := "maintenance-drain-prepared-test"
+	defer func() {
+		forgetDrainStart(name)
+		drainStartsMutex.Lock()
+		delete(drainArmed, name)
+		drainStartsMutex.Unlock()
+	}()
+
+	if drainPrepared(name) {
+		t.Fatalf("Expected drain not to be prepared for a new middleware")
+	}
+
+	cfg := &Config{
+		MaintenanceContent:  "<html><body>Maintenance</body></html>",
+		DrainMode:           true,
+		DrainSessionCookies: []string{"session"},
+	}
+	if _, err := New(context.Background(), http.NotFoundHandler(), cfg, name); err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	if !drainPrepared(name) {
+		t.Errorf("Expected drain to be prepared once markers are issued ahead of maintenance")
+	}
+	if drainPrepared("maintenance-drain-unprepared-test") {
+		t.Errorf("Expected other middlewares not to be prepared")
+	}
+}
+
+// TestDrainModeValidation tests that invalid drain configurations are rejected
+func TestDrainModeValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name: "Missing session cookies",
+			config: &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Enabled:            true,
+				DrainMode:          true,
+			},
+		},
+		{
+			name: "Invalid start time",
+			config: &Config{
+				MaintenanceContent:  "<html><body>Maintenance</body></html>",
+				Enabled:             true,
+				DrainMode:           true,
+				DrainSessionCookies: []string{"session"},
+				DrainStartTime:      "yesterday",
+			},
+		},
+		{
+			name: "Shared state without a drain secret",
+			config: &Config{
+				MaintenanceContent:  "<html><body>Maintenance</body></html>",
+				DrainMode:           true,
+				DrainSessionCookies: []string{"session"},
+				MaintenanceGroup:    "shop",
+				StateFile:           "/var/lib/traefik/maintenance.json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(context.Background(), nextHandler, tc.config, "maintenance-drain-invalid"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package traefik_maintenance_warden
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTBypassConfig configures bypassing maintenance with a signed JWT.
+// It is enabled as soon as a secret, a public key or a JWKS file is configured.
+// Tokens must carry an "exp" claim and the required claim.
+type JWTBypassConfig struct {
+	// Cookie is the name of a cookie holding the token
+	Cookie string `json:"cookie,omitempty"`
+
+	// Header is the header holding the token, with or without a "Bearer " prefix. Defaults to Authorization.
+	Header string `json:"header,omitempty"`
+
+	// Secret is the shared secret for HS256 tokens
+	Secret string `json:"secret,omitempty"`
+
+	// SecretFile is a file holding the shared secret for HS256 tokens
+	SecretFile string `json:"secretFile,omitempty"`
+
+	// PublicKeys are PEM encoded RSA or ECDSA public keys or certificates for RS256 and ES256 tokens
+	PublicKeys []string `json:"publicKeys,omitempty"`
+
+	// PublicKeyFiles are files holding PEM encoded public keys or certificates
+	PublicKeyFiles []string `json:"publicKeyFiles,omitempty"`
+
+	// JWKSFile is a JSON Web Key Set file, reloaded when it changes
+	JWKSFile string `json:"jwksFile,omitempty"`
+
+	// Issuer is the required "iss" claim
+	Issuer string `json:"issuer,omitempty"`
+
+	// Audience is a required entry of the "aud" claim
+	Audience string `json:"audience,omitempty"`
+
+	// RequiredClaim is the claim that must hold RequiredValue, e.g. "roles" or "realm_access.roles".
+	// It is mandatory, so ordinary tokens from the same identity provider don't bypass maintenance.
+	RequiredClaim string `json:"requiredClaim,omitempty"`
+
+	// RequiredValue is the value RequiredClaim must equal or, for lists, contain
+	RequiredValue string `json:"requiredValue,omitempty"`
+
+	// ClockSkew is the leeway in seconds applied to "exp" and "nbf"
+	ClockSkew int `json:"clockSkew,omitempty"`
+}
+
+// errJWTSignature marks tokens with an invalid signature, which count as failed bypass attempts
+var errJWTSignature = errors.New("invalid token signature")
+
+// jwtKey is a verification key, optionally identified by a key ID
+type jwtKey struct {
+	kid string
+	key interface{}
+}
+
+// jwtVerifier validates bypass tokens
+type jwtVerifier struct {
+	config      JWTBypassConfig
+	header      string
+	staticKeys  []jwtKey
+	jwksKeys    []jwtKey
+	jwksLastMod time.Time
+	jwksError   string
+	jwksMutex   sync.RWMutex
+	clockSkew   time.Duration
+}
+
+// configured reports whether a verification key is set, enabling JWT bypass
+func (c JWTBypassConfig) configured() bool {
+	return c.Secret != "" || c.SecretFile != "" || len(c.PublicKeys) > 0 ||
+		len(c.PublicKeyFiles) > 0 || c.JWKSFile != ""
+}
+
+// newJWTVerifier loads the configured keys of a validated configuration. It returns nil when
+// JWT bypass isn't configured.
+func newJWTVerifier(config JWTBypassConfig) (*jwtVerifier, error) {
+	if !config.configured() {
+		return nil, nil
+	}
+
+	v := &jwtVerifier{
+		config:    config,
+		header:    config.Header,
+		clockSkew: time.Duration(config.ClockSkew) * time.Second,
+	}
+	if v.header == "" {
+		v.header = "Authorization"
+	}
+
+	secret := config.Secret
+	if config.SecretFile != "" {
+		content, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JWT secret file: %w", err)
+		}
+		secret = strings.TrimSpace(string(content))
+	}
+	if secret != "" {
+		v.staticKeys = append(v.staticKeys, jwtKey{key: []byte(secret)})
+	}
+
+	pems := append([]string{}, config.PublicKeys...)
+	for _, path := range config.PublicKeyFiles {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JWT public key file: %w", err)
+		}
+		pems = append(pems, string(content))
+	}
+	for _, data := range pems {
+		key, err := parsePublicKeyPEM([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		v.staticKeys = append(v.staticKeys, jwtKey{key: key})
+	}
+
+	if config.JWKSFile != "" {
+		if err := v.loadJWKS(); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// parsePublicKeyPEM parses a PEM encoded public key or certificate
+func parsePublicKeyPEM(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM public key")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA public key: %w", err)
+		}
+		return key, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		return key, nil
+	}
+}
+
+// jsonWebKey is a single key of a JSON Web Key Set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJWKS reads the JWKS file if it changed since it was last loaded
+func (v *jwtVerifier) loadJWKS() error {
+	fileInfo, err := os.Stat(v.config.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("error accessing JWKS file: %w", err)
+	}
+
+	v.jwksMutex.RLock()
+	unchanged := v.jwksKeys != nil && !fileInfo.ModTime().After(v.jwksLastMod)
+	v.jwksMutex.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(v.config.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("error reading JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return fmt.Errorf("invalid JWKS file: %w", err)
+	}
+
+	keys := make([]jwtKey, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return fmt.Errorf("invalid JWKS key %q: %w", jwk.Kid, err)
+		}
+		keys = append(keys, jwtKey{kid: jwk.Kid, key: key})
+	}
+
+	v.jwksMutex.Lock()
+	v.jwksKeys = keys
+	v.jwksLastMod = fileInfo.ModTime()
+	v.jwksMutex.Unlock()
+
+	return nil
+}
+
+// recordJWKSError remembers the outcome of the last JWKS reload, reporting whether err is
+// a failure different from the previous one
+func (v *jwtVerifier) recordJWKSError(err error) bool {
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	v.jwksMutex.Lock()
+	defer v.jwksMutex.Unlock()
+
+	changed := message != "" && message != v.jwksError
+	v.jwksError = message
+	return changed
+}
+
+// publicKey converts the JSON Web Key into a verification key
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return key, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key value: %w", err)
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// token extracts the bypass token from the request
+func (v *jwtVerifier) token(req *http.Request) string {
+	if v.config.Cookie != "" {
+		if cookie, err := req.Cookie(v.config.Cookie); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	value := req.Header.Get(v.header)
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return value
+}
+
+// verify validates the token and returns its claims
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding")
+	}
+
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if err := v.validateClaims(claims, now); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// decodeJWTSegment decodes a base64url encoded JSON token segment
+func decodeJWTSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// verifySignature checks the signature against every key compatible with the algorithm.
+// The key type must match the algorithm so a public key can never be used as an HMAC secret.
+func (v *jwtVerifier) verifySignature(alg, kid, signingInput string, signature []byte) error {
+	keys := v.staticKeys
+	if v.config.JWKSFile != "" {
+		v.jwksMutex.RLock()
+		keys = append(append([]jwtKey{}, keys...), v.jwksKeys...)
+		v.jwksMutex.RUnlock()
+	}
+
+	digest := sha256.Sum256([]byte(signingInput))
+	for _, candidate := range keys {
+		if kid != "" && candidate.kid != "" && candidate.kid != kid {
+			continue
+		}
+
+		switch key := candidate.key.(type) {
+		case []byte:
+			if alg != "HS256" {
+				continue
+			}
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if alg != "RS256" {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if alg != "ES256" || len(signature) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+
+	switch alg {
+	case "HS256", "RS256", "ES256":
+		return errJWTSignature
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+}
+
+// validateClaims checks the time, issuer, audience and required claims
+func (v *jwtVerifier) validateClaims(claims map[string]interface{}, now time.Time) error {
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(v.clockSkew)) {
+			return fmt.Errorf("token has expired")
+		}
+	} else {
+		return fmt.Errorf("token has no expiry")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(v.clockSkew).Before(time.Unix(int64(nbf), 0)) {
+			return fmt.Errorf("token is not valid yet")
+		}
+	}
+
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return fmt.Errorf("unexpected token issuer %v", claims["iss"])
+	}
+
+	if v.config.Audience != "" && !claimContains(claims["aud"], v.config.Audience) {
+		return fmt.Errorf("token audience doesn't include %q", v.config.Audience)
+	}
+
+	if !claimContains(lookupClaim(claims, v.config.RequiredClaim), v.config.RequiredValue) {
+		return fmt.Errorf("token claim %q doesn't contain %q", v.config.RequiredClaim, v.config.RequiredValue)
+	}
+
+	return nil
+}
+
+// lookupClaim resolves a dotted claim path such as "realm_access.roles"
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// claimContains reports whether a claim equals the value, contains it in a list,
+// or contains it as a space separated scope
+func claimContains(claim interface{}, value string) bool {
+	switch typed := claim.(type) {
+	case string:
+		if typed == value {
+			return true
+		}
+		for _, field := range strings.Fields(typed) {
+			if field == value {
+				return true
+			}
+		}
+	case bool:
+		return fmt.Sprint(typed) == value
+	case []interface{}:
+		for _, item := range typed {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchJWTBypass reports whether the request carries a valid bypass token, returning its subject
+func (m *MaintenanceBypass) matchJWTBypass(req *http.Request) (string, bool) {
+	if m.jwtVerifier == nil {
+		return "", false
+	}
+
+	token := m.jwtVerifier.token(req)
+	if token == "" {
+		return "", false
+	}
+
+	// A failure that persists is logged once rather than on every request carrying a token
+	if m.jwtVerifier.config.JWKSFile != "" {
+		err := m.jwtVerifier.loadJWKS()
+		if m.jwtVerifier.recordJWKSError(err) {
+			m.logRequest(req, LogLevelError, "Failed to reload JWKS file: %v", err)
+		}
+	}
+
+	claims, err := m.jwtVerifier.verify(token, time.Now())
+	if err != nil {
+		if errors.Is(err, errJWTSignature) {
+			m.recordBypassFailure(req, "JWT")
+		} else {
+			m.logRequest(req, LogLevelDebug, "Rejected bypass token: %v", err)
+		}
+		return "", false
+	}
+
+	subject, _ := claims["sub"].(string)
+	return subject, true
+}
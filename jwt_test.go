@@ -0,0 +1,315 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signTestJWT creates a signed token for tests
+func signTestJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// publicKeyPEM encodes a public key as PEM for tests
+func publicKeyPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// TestJWTBypass tests bypassing maintenance with HS256, RS256 and ES256 tokens
+func TestJWTBypass(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	secret := []byte("shared-secret")
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+		JWTBypass: JWTBypassConfig{
+			Cookie:        "staff_token",
+			Secret:        string(secret),
+			PublicKeys:    []string{publicKeyPEM(t, &rsaKey.PublicKey), publicKeyPEM(t, &ecKey.PublicKey)},
+			Issuer:        "https://sso.example.com",
+			Audience:      "maintenance",
+			RequiredClaim: "realm_access.roles",
+			RequiredValue: "maintenance-bypass",
+		},
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":          "alice",
+			"iss":          "https://sso.example.com",
+			"aud":          []string{"account", "maintenance"},
+			"exp":          time.Now().Add(time.Hour).Unix(),
+			"nbf":          time.Now().Add(-time.Minute).Unix(),
+			"realm_access": map[string]interface{}{"roles": []string{"staff", "maintenance-bypass"}},
+		}
+	}
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	testCases := []struct {
+		name           string
+		token          string
+		inCookie       bool
+		expectedStatus int
+	}{
+		{"HS256 token in Authorization header", signTestJWT(t, "HS256", "", secret, validClaims()), false, http.StatusOK},
+		{"RS256 token in cookie", signTestJWT(t, "RS256", "", rsaKey, validClaims()), true, http.StatusOK},
+		{"ES256 token", signTestJWT(t, "ES256", "", ecKey, validClaims()), false, http.StatusOK},
+		{"Token signed with unknown key", signTestJWT(t, "ES256", "", otherKey, validClaims()), false, http.StatusServiceUnavailable},
+		{"Algorithm not matching the key", signTestJWT(t, "HS256", "", []byte(publicKeyPEM(t, &rsaKey.PublicKey)), validClaims()), false, http.StatusServiceUnavailable},
+		{"Unsigned token", "eyJhbGciOiJub25lIn0.eyJzdWIiOiJhbGljZSJ9.", false, http.StatusServiceUnavailable},
+		{"Expired token", signTestJWT(t, "HS256", "", secret, withClaim("exp", time.Now().Add(-time.Hour).Unix())), false, http.StatusServiceUnavailable},
+		{"Token without expiry", signTestJWT(t, "HS256", "", secret, withClaim("exp", nil)), false, http.StatusServiceUnavailable},
+		{"Token not valid yet", signTestJWT(t, "HS256", "", secret, withClaim("nbf", time.Now().Add(time.Hour).Unix())), false, http.StatusServiceUnavailable},
+		{"Wrong issuer", signTestJWT(t, "HS256", "", secret, withClaim("iss", "https://evil.example.com")), false, http.StatusServiceUnavailable},
+		{"Wrong audience", signTestJWT(t, "HS256", "", secret, withClaim("aud", "billing")), false, http.StatusServiceUnavailable},
+		{"Missing role", signTestJWT(t, "HS256", "", secret, withClaim("realm_access", map[string]interface{}{"roles": []string{"staff"}})), false, http.StatusServiceUnavailable},
+		{"Token without the required claim", signTestJWT(t, "HS256", "", secret, withClaim("realm_access", nil)), false, http.StatusServiceUnavailable},
+		{"Malformed token", "not-a-token", false, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tc.inCookie {
+				req.AddCookie(&http.Cookie{Name: "staff_token", Value: tc.token})
+			} else {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Result().StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, recorder.Result().StatusCode)
+			}
+		})
+	}
+}
+
+// TestJWTBypassJWKS tests verifying tokens against a JWKS file that is reloaded when it changes
+func TestJWTBypassJWKS(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	encode := func(data []byte) string { return base64.RawURLEncoding.EncodeToString(data) }
+	rsaJWK := map[string]string{
+		"kty": "RSA", "kid": "rsa-1", "use": "sig",
+		"n": encode(rsaKey.N.Bytes()),
+		"e": encode([]byte{1, 0, 1}),
+	}
+	ecJWK := map[string]string{
+		"kty": "EC", "kid": "ec-1", "crv": "P-256",
+		"x": encode(ecKey.X.FillBytes(make([]byte, 32))),
+		"y": encode(ecKey.Y.FillBytes(make([]byte, 32))),
+	}
+
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-jwks")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	jwksPath := filepath.Join(tmpDir, "jwks.json")
+	writeJWKS := func(keys ...map[string]string) {
+		data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		if err := ioutil.WriteFile(jwksPath, data, 0644); err != nil {
+			t.Fatalf("Failed to write JWKS file: %v", err)
+		}
+	}
+	writeJWKS(rsaJWK)
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+		JWTBypass:          JWTBypassConfig{JWKSFile: jwksPath, RequiredClaim: "roles", RequiredValue: "maintenance-bypass"},
+		LogLevel:           int(LogLevelError),
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	claims := map[string]interface{}{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"maintenance-bypass"}}
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+		return recorder.Result().StatusCode
+	}
+
+	if status := serve(signTestJWT(t, "RS256", "rsa-1", rsaKey, claims)); status != http.StatusOK {
+		t.Errorf("Expected RS256 token with matching kid to bypass, got %d", status)
+	}
+
+	if status := serve(signTestJWT(t, "RS256", "rsa-2", rsaKey, claims)); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected token with unknown kid to be rejected, got %d", status)
+	}
+
+	if status := serve(signTestJWT(t, "ES256", "ec-1", ecKey, claims)); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected ES256 token to be rejected before key rotation, got %d", status)
+	}
+
+	// Rotate the keys and make sure the file is seen as modified
+	writeJWKS(ecJWK)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(jwksPath, future, future)
+
+	if status := serve(signTestJWT(t, "ES256", "ec-1", ecKey, claims)); status != http.StatusOK {
+		t.Errorf("Expected ES256 token to bypass after key rotation, got %d", status)
+	}
+
+	if status := serve(signTestJWT(t, "RS256", "rsa-1", rsaKey, claims)); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected rotated out RS256 key to be rejected, got %d", status)
+	}
+
+	// A broken update keeps the previous keys and is logged once
+	logBuffer := &testLogWriter{}
+	middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+	if err := ioutil.WriteFile(jwksPath, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write JWKS file: %v", err)
+	}
+	future = future.Add(time.Minute)
+	os.Chtimes(jwksPath, future, future)
+
+	for i := 0; i < 3; i++ {
+		if status := serve(signTestJWT(t, "ES256", "ec-1", ecKey, claims)); status != http.StatusOK {
+			t.Errorf("Expected the previous keys to be kept, got %d", status)
+		}
+	}
+	if count := strings.Count(logBuffer.String(), "Failed to reload JWKS file"); count != 1 {
+		t.Errorf("Expected the reload failure to be logged once, got %d times", count)
+	}
+}
+
+// TestJWTBypassValidation tests that invalid JWT bypass configurations are rejected
+func TestJWTBypassValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name   string
+		config JWTBypassConfig
+	}{
+		{"Invalid PEM key", JWTBypassConfig{PublicKeys: []string{"not a key"}, RequiredClaim: "roles", RequiredValue: "staff"}},
+		{"Missing key file", JWTBypassConfig{PublicKeyFiles: []string{"/nonexistent/key.pem"}, RequiredClaim: "roles", RequiredValue: "staff"}},
+		{"Missing JWKS file", JWTBypassConfig{JWKSFile: "/nonexistent/jwks.json", RequiredClaim: "roles", RequiredValue: "staff"}},
+		{"Required claim without value", JWTBypassConfig{Secret: "secret", RequiredClaim: "roles"}},
+		{"Missing required claim", JWTBypassConfig{Secret: "secret"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Enabled:            true,
+				JWTBypass:          tc.config,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
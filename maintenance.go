@@ -5,12 +5,13 @@ package traefik_maintenance_warden
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -38,6 +39,17 @@ type Config struct {
 	// MaintenanceFilePath is the path to a static HTML file to serve instead of redirecting
 	MaintenanceFilePath string `json:"maintenanceFilePath,omitempty"`
 
+	// MaintenanceFileMaxSize is the largest maintenance file or content accepted, in bytes
+	MaintenanceFileMaxSize int `json:"maintenanceFileMaxSize,omitempty"`
+
+	// MaintenanceFileBaseDir is the directory the maintenance file must resolve into, symlinks
+	// included. Defaults to the directory of MaintenanceFilePath.
+	MaintenanceFileBaseDir string `json:"maintenanceFileBaseDir,omitempty"`
+
+	// MaintenanceFileRejectSymlinks refuses a maintenance file that is a symlink. By default
+	// symlinks are followed within MaintenanceFileBaseDir, as used by Kubernetes ConfigMap volumes.
+	MaintenanceFileRejectSymlinks bool `json:"maintenanceFileRejectSymlinks,omitempty"`
+
 	// MaintenanceContent is the direct HTML content to serve instead of a file or service
 	MaintenanceContent string `json:"maintenanceContent,omitempty"`
 
@@ -47,6 +59,10 @@ type Config struct {
 	// BypassHeaderValue is the expected value of the bypass header
 	BypassHeaderValue string `json:"bypassHeaderValue,omitempty"`
 
+	// BypassHeaderValues are additional accepted values of the bypass header, each with an optional
+	// label for logs. Values may be read from a file or an environment variable.
+	BypassHeaderValues []BypassValue `json:"bypassHeaderValues,omitempty"`
+
 	// Enabled controls whether the maintenance mode is active
 	Enabled bool `json:"enabled,omitempty"`
 
@@ -56,6 +72,35 @@ type Config struct {
 	// BypassPaths are paths that should bypass maintenance mode
 	BypassPaths []string `json:"bypassPaths,omitempty"`
 
+	// BypassQueryParam is a query parameter accepting the bypass header values. A valid value is
+	// exchanged for a signed bypass cookie and the client is redirected to the URL without it.
+	BypassQueryParam string `json:"bypassQueryParam,omitempty"`
+
+	// BypassCookieName is the name of the cookie set after a valid bypass query parameter
+	BypassCookieName string `json:"bypassCookieName,omitempty"`
+
+	// BypassCookieMaxAge is how long the bypass cookie stays valid, in seconds
+	BypassCookieMaxAge int `json:"bypassCookieMaxAge,omitempty"`
+
+	// JWTBypass lets requests carrying a valid signed JWT bypass maintenance mode
+	JWTBypass JWTBypassConfig `json:"jwtBypass,omitempty"`
+
+	// BasicAuthBypass lets requests carrying valid HTTP Basic credentials bypass maintenance mode
+	BasicAuthBypass BasicAuthConfig `json:"basicAuthBypass,omitempty"`
+
+	// BypassMaxFailures is the number of wrong bypass header values a client IP may send within
+	// BypassFailureWindow before it is banned from every bypass mechanism (0 disables)
+	BypassMaxFailures int `json:"bypassMaxFailures,omitempty"`
+
+	// BypassFailureWindow is the window in which failed bypass attempts are counted, in seconds
+	BypassFailureWindow int `json:"bypassFailureWindow,omitempty"`
+
+	// BypassBanDuration is how long a client IP stays banned, in seconds
+	BypassBanDuration int `json:"bypassBanDuration,omitempty"`
+
+	// BypassBanMaxClients bounds the number of client IPs tracked for failed bypass attempts
+	BypassBanMaxClients int `json:"bypassBanMaxClients,omitempty"`
+
 	// BypassFavicon controls whether favicon.ico requests bypass maintenance mode
 	BypassFavicon bool `json:"bypassFavicon,omitempty"`
 
@@ -67,61 +112,377 @@ type Config struct {
 
 	// ContentType is the content type header to set when serving the maintenance file
 	ContentType string `json:"contentType,omitempty"`
+
+	// ProxyRequestHeaders rewrites the headers sent to the maintenance service.
+	// Values may use the {host}, {uri}, {path}, {method}, {scheme} and {remote_addr} placeholders.
+	ProxyRequestHeaders HeaderRules `json:"proxyRequestHeaders,omitempty"`
+
+	// ProxyResponseHeaders rewrites the headers returned by the maintenance service
+	ProxyResponseHeaders HeaderRules `json:"proxyResponseHeaders,omitempty"`
+
+	// ProxyForwardCredentials forwards Cookie and Authorization headers to the maintenance service.
+	// They are stripped by default.
+	ProxyForwardCredentials bool `json:"proxyForwardCredentials,omitempty"`
+
+	// TrafficPercentage is the percentage of clients (1-100) sent to the maintenance page.
+	// Zero is treated as 100.
+	TrafficPercentage int `json:"trafficPercentage,omitempty"`
+
+	// TrafficKey identifies clients for a sticky rollout: "ip", "header:<name>" or "cookie:<name>".
+	// Clients without the header or cookie are identified by their IP.
+	TrafficKey string `json:"trafficKey,omitempty"`
+
+	// DrainMode lets requests from existing sessions pass through during a grace period
+	// while new visitors get the maintenance page right away. Sessions are recognised by a marker
+	// cookie issued while maintenance is off, so drain mode must be enabled ahead of maintenance:
+	// enabling both at once lets no session through. With several Traefik instances, set DrainSecret.
+	DrainMode bool `json:"drainMode,omitempty"`
+
+	// DrainSessionCookies are the cookie names identifying an existing session
+	DrainSessionCookies []string `json:"drainSessionCookies,omitempty"`
+
+	// DrainGracePeriod is how long existing sessions may keep passing through, in seconds
+	DrainGracePeriod int `json:"drainGracePeriod,omitempty"`
+
+	// DrainStartTime is the RFC3339 time the drain started. Defaults to when maintenance was switched on.
+	DrainStartTime string `json:"drainStartTime,omitempty"`
+
+	// DrainSecret signs the cookie marking visitors seen before drain started. Set the same value on
+	// every Traefik instance; by default each process signs with its own random key. Required when
+	// the maintenance state is shared through a group, Redis or Consul.
+	DrainSecret string `json:"drainSecret,omitempty"`
+
+	// WebSocketPolicy controls how upgrade requests are handled during maintenance:
+	// "reject" (default), "allow" or "maintenance"
+	WebSocketPolicy string `json:"webSocketPolicy,omitempty"`
+
+	// SSEPolicy controls how Server-Sent Events requests are handled during maintenance:
+	// "reject" (default), "allow", "maintenance" or "event"
+	SSEPolicy string `json:"ssePolicy,omitempty"`
+
+	// StreamStatusCode is the HTTP status code used to reject upgrade and event stream requests.
+	// Defaults to StatusCode.
+	StreamStatusCode int `json:"streamStatusCode,omitempty"`
+
+	// RateLimitAverage is the number of maintenance responses per second allowed per client IP (0 disables)
+	RateLimitAverage int `json:"rateLimitAverage,omitempty"`
+
+	// RateLimitBurst is the number of maintenance responses a client IP may receive in a burst
+	RateLimitBurst int `json:"rateLimitBurst,omitempty"`
+
+	// RateLimitGlobalAverage is the number of maintenance responses per second allowed overall (0 disables)
+	RateLimitGlobalAverage int `json:"rateLimitGlobalAverage,omitempty"`
+
+	// RateLimitGlobalBurst is the number of maintenance responses allowed overall in a burst
+	RateLimitGlobalBurst int `json:"rateLimitGlobalBurst,omitempty"`
+
+	// RateLimitMaxClients bounds the number of client IPs tracked by the rate limiter
+	RateLimitMaxClients int `json:"rateLimitMaxClients,omitempty"`
+
+	// RedirectURL is an external status page to redirect to instead of serving content
+	RedirectURL string `json:"redirectURL,omitempty"`
+
+	// RedirectStatusCode is the status code used for the redirect (301, 302, 303, 307 or 308)
+	RedirectStatusCode int `json:"redirectStatusCode,omitempty"`
+
+	// RedirectReturnTo appends the original URL to the redirect as a returnTo query parameter
+	RedirectReturnTo bool `json:"redirectReturnTo,omitempty"`
+
+	// APIPaths are path patterns identifying API requests, which get JSON instead of a redirect.
+	// Requests accepting application/json but not text/html are always treated as API requests.
+	APIPaths []string `json:"apiPaths,omitempty"`
+
+	// Rules are evaluated in order before the built-in bypass checks; the first matching rule wins
+	Rules []Rule `json:"rules,omitempty"`
+
+	// UserAgentPolicies decide how crawlers and monitors are treated once no bypass condition is met.
+	// They are evaluated in order; the first policy matching the User-Agent wins.
+	UserAgentPolicies []UserAgentPolicy `json:"userAgentPolicies,omitempty"`
+
+	// MaintenancePaths restricts maintenance to the matching sections of the application, each with
+	// its own content and status code. Requests outside every section pass through.
+	MaintenancePaths []MaintenancePath `json:"maintenancePaths,omitempty"`
+
+	// CORS answers preflights and lets other origins read maintenance responses
+	CORS CORSConfig `json:"cors,omitempty"`
+
+	// MaintenanceGroup names a group of middleware instances sharing their maintenance state,
+	// e.g. every router of an application. Requires StateFile.
+	MaintenanceGroup string `json:"maintenanceGroup,omitempty"`
+
+	// StateFile is the JSON file holding the shared state of maintenance groups. Once a group's
+	// state has been written, it takes precedence over Enabled for every instance of the group.
+	// The middleware has no endpoint changing the state: operators toggle maintenance by writing
+	// the file themselves, e.g. {"groups": {"shop": {"enabled": true}}}, with an atomic rename.
+	StateFile string `json:"stateFile,omitempty"`
+
+	// RedisState keeps the maintenance state in sync with a key on a Redis-compatible server
+	RedisState RedisStateConfig `json:"redisState,omitempty"`
+
+	// ConsulState keeps the maintenance state in sync with a Consul KV key
+	ConsulState ConsulStateConfig `json:"consulState,omitempty"`
+
+	// Webhooks are notified when maintenance starts or ends, whether through SetEnabled, a change
+	// read from a state file, Redis or Consul, or a configuration reload switching Enabled. The
+	// state found at startup is not a change. Only instances with NotifyWebhooks send notifications.
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+
+	// NotifyWebhooks makes this instance send the webhook notifications. Every instance following
+	// a shared state, and every Traefik replica, sees the same change, so enable it on a single
+	// instance for each change to be announced once.
+	NotifyWebhooks bool `json:"notifyWebhooks,omitempty"`
+
+	// RequestIDHeader carries the request ID, generated when a request has none. It is set on
+	// maintenance responses, forwarded to the maintenance service and included in log lines.
+	RequestIDHeader string `json:"requestIDHeader,omitempty"`
+
+	// ResponseHeaders are set on every maintenance response, whatever the content source, after the
+	// built-in headers. An empty value removes the header. Values may use the request placeholders
+	// as well as {request_id}, {trace_id}, {end_time} and {retry_after}.
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+
+	// MaintenanceEndTime is the RFC3339 time maintenance is expected to end. It sets Retry-After
+	// and the {end_time} placeholder.
+	MaintenanceEndTime string `json:"maintenanceEndTime,omitempty"`
+
+	// DefaultPage customizes the built-in page served when no maintenance service, file, content
+	// or redirect URL is configured
+	DefaultPage DefaultPageConfig `json:"defaultPage,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
 func CreateConfig() *Config {
 	return &Config{
-		MaintenanceService:  "",
-		MaintenanceFilePath: "",
-		MaintenanceContent:  "",
-		BypassHeader:        "X-Maintenance-Bypass",
-		BypassHeaderValue:   "true",
-		Enabled:             true,
-		StatusCode:          503,
-		BypassPaths:         []string{},
-		BypassFavicon:       true,
-		LogLevel:            int(LogLevelError),
-		MaintenanceTimeout:  10,
-		ContentType:         "text/html; charset=utf-8",
+		MaintenanceService:            "",
+		MaintenanceFilePath:           "",
+		MaintenanceFileMaxSize:        defaultMaintenanceFileMaxSize,
+		MaintenanceFileBaseDir:        "",
+		MaintenanceFileRejectSymlinks: false,
+		MaintenanceContent:            "",
+		BypassHeader:                  "X-Maintenance-Bypass",
+		BypassHeaderValue:             "true",
+		BypassHeaderValues:            []BypassValue{},
+		Enabled:                       true,
+		StatusCode:                    503,
+		BypassPaths:                   []string{},
+		BypassFavicon:                 true,
+		BypassQueryParam:              "",
+		BypassCookieName:              "maintenance_bypass",
+		BypassCookieMaxAge:            3600,
+		BypassMaxFailures:             0,
+		BypassFailureWindow:           300,
+		BypassBanDuration:             900,
+		BypassBanMaxClients:           10000,
+		LogLevel:                      int(LogLevelError),
+		MaintenanceTimeout:            10,
+		ContentType:                   "text/html; charset=utf-8",
+		TrafficPercentage:             100,
+		TrafficKey:                    "ip",
+		DrainMode:                     false,
+		DrainSessionCookies:           []string{},
+		DrainGracePeriod:              900,
+		DrainStartTime:                "",
+		WebSocketPolicy:               StreamPolicyReject,
+		SSEPolicy:                     StreamPolicyReject,
+		StreamStatusCode:              0,
+		RateLimitAverage:              0,
+		RateLimitBurst:                0,
+		RateLimitMaxClients:           10000,
+		Rules:                         []Rule{},
+		RequestIDHeader:               defaultRequestIDHeader,
+		ResponseHeaders:               map[string]string{},
+		MaintenanceEndTime:            "",
+		UserAgentPolicies:             []UserAgentPolicy{},
+		MaintenancePaths:              []MaintenancePath{},
+		RedirectURL:                   "",
+		RedirectStatusCode:            http.StatusFound,
+		RedirectReturnTo:              false,
+		APIPaths:                      []string{},
 	}
 }
 
 // MaintenanceBypass is a middleware that redirects all traffic to a maintenance page
 // unless the request has a specific bypass header.
 type MaintenanceBypass struct {
-	next                   http.Handler
-	maintenanceService     *url.URL
-	maintenanceFilePath    string
-	maintenanceFileContent []byte
-	maintenanceContent     string
-	maintenanceFileLastMod time.Time
-	fileMutex              sync.RWMutex
-	bypassHeader           string
-	bypassHeaderValue      string
-	enabled                bool
-	statusCode             int
-	bypassPaths            []string
-	bypassFavicon          bool
-	name                   string
-	logger                 *log.Logger
-	logLevel               LogLevel
-	timeout                time.Duration
-	contentType            string
+	next                    http.Handler
+	maintenanceService      *url.URL
+	maintenanceFilePath     string
+	maintenanceFileMaxSize  int64
+	maintenanceFileBaseDir  string
+	rejectSymlinks          bool
+	maintenanceFileContent  []byte
+	maintenanceContent      string
+	maintenanceFileLastMod  time.Time
+	maintenanceFileError    string
+	fileMutex               sync.RWMutex
+	bypassHeader            string
+	bypassSecrets           []bypassSecret
+	enabled                 bool
+	statusCode              int
+	bypassPaths             []string
+	bypassFavicon           bool
+	failureTracker          *failureTracker
+	bypassQueryParam        string
+	bypassCookieName        string
+	bypassCookieMaxAge      time.Duration
+	jwtVerifier             *jwtVerifier
+	htpasswd                *htpasswdStore
+	basicAuth               BasicAuthConfig
+	name                    string
+	logger                  *log.Logger
+	logLevel                LogLevel
+	timeout                 time.Duration
+	contentType             string
+	proxyRequestHeaders     HeaderRules
+	proxyResponseHeaders    HeaderRules
+	proxyForwardCredentials bool
+	trafficPercentage       int
+	trafficKey              trafficKey
+	drainEnabled            bool
+	drainSessionCookies     []string
+	drainGracePeriod        time.Duration
+	drainStart              time.Time
+	drainStartTime          string
+	drainKey                []byte
+	webSocketPolicy         string
+	ssePolicy               string
+	streamStatusCode        int
+	rateLimiter             *rateLimiter
+	rules                   []compiledRule
+	userAgentPolicies       []compiledUserAgentPolicy
+	maintenancePaths        []compiledMaintenancePath
+	cors                    CORSConfig
+	stateFile               *stateFile
+	stateMutex              sync.RWMutex
+	webhooks                *webhookDispatcher
+	requestIDHeader         string
+	responseHeaders         map[string]string
+	maintenanceEndTime      time.Time
+	defaultPage             *defaultPage
+	redirectURL             *url.URL
+	redirectStatusCode      int
+	redirectReturnTo        bool
+	apiPaths                []pathMatcher
 }
 
 // New creates a new MaintenanceBypass middleware.
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	// Default to 503 Service Unavailable if not specified
-	statusCode := config.StatusCode
-	if statusCode == 0 {
-		statusCode = http.StatusServiceUnavailable
+	// Report every configuration problem at once, keeping the parts compiled while validating
+	compiled, warnings, err := config.compile()
+	if err != nil {
+		return nil, err
+	}
+	statusCode := compiled.statusCode
+
+	// Default to sending all traffic to maintenance if not specified
+	trafficPercentage := config.TrafficPercentage
+	if trafficPercentage == 0 {
+		trafficPercentage = 100
+	}
+
+	// Resolve the drain period, keeping the original start across configuration reloads
+	var drainStart time.Time
+	var drainKey []byte
+	if config.DrainMode {
+		drainKey = resolveDrainKey(name, config.DrainSecret)
+	}
+	drainGracePeriod := time.Duration(config.DrainGracePeriod) * time.Second
+	if config.DrainMode && drainGracePeriod <= 0 {
+		drainGracePeriod = 15 * time.Minute
+	}
+	if config.DrainMode && !config.Enabled {
+		armDrain(name)
+	}
+	if config.DrainMode && config.Enabled {
+		if !drainPrepared(name) {
+			warnings = append(warnings, ConfigProblem{
+				Field:   "drainMode",
+				Message: "enabled together with maintenance: no visitor carries a drain marker yet, so no session is let through",
+			})
+		}
+		drainStart, _ = resolveDrainStart(name, config.DrainStartTime, time.Now())
+	} else if config.MaintenanceGroup == "" && config.RedisState.Address == "" && config.ConsulState.Address == "" {
+		// With a shared state, the state read at startup decides whether the drain goes on
+		forgetDrainStart(name)
+	}
+
+	// Default to the maintenance status code for rejected streams
+	streamStatusCode := config.StreamStatusCode
+	if streamStatusCode == 0 {
+		streamStatusCode = statusCode
 	}
 
-	// Default content type if not specified
-	contentType := config.ContentType
-	if contentType == "" {
-		contentType = "text/html; charset=utf-8"
+	// Only create a rate limiter when a limit is configured
+	var limiter *rateLimiter
+	if config.RateLimitAverage > 0 || config.RateLimitGlobalAverage > 0 {
+		maxClients := config.RateLimitMaxClients
+		if maxClients <= 0 {
+			maxClients = 10000
+		}
+		limiter = newRateLimiter(config.RateLimitAverage, config.RateLimitBurst,
+			config.RateLimitGlobalAverage, config.RateLimitGlobalBurst, maxClients)
+	}
+
+	// Share the maintenance state with the other instances of the group
+	var groupState *stateFile
+	if config.MaintenanceGroup != "" {
+		groupState = newStateFile(config.StateFile, config.MaintenanceGroup)
+	}
+
+	// Default the request ID header if not specified
+	requestIDHeader := config.RequestIDHeader
+	if requestIDHeader == "" {
+		requestIDHeader = defaultRequestIDHeader
+	}
+
+	// Files and environment variables are read here rather than by Validate. Their problems are
+	// collected and reported at once, like configuration problems.
+	resources := &configValidator{}
+
+	// Load the accepted bypass header values
+	bypassSecrets := loadBypassSecrets(resources, config)
+
+	// Default the bypass cookie settings if not specified
+	bypassCookieName := config.BypassCookieName
+	if bypassCookieName == "" {
+		bypassCookieName = "maintenance_bypass"
+	}
+	bypassCookieMaxAge := time.Duration(config.BypassCookieMaxAge) * time.Second
+	if bypassCookieMaxAge <= 0 {
+		bypassCookieMaxAge = time.Hour
+	}
+
+	// Load the JWT bypass keys
+	verifier, err := newJWTVerifier(config.JWTBypass)
+	resources.check("jwtBypass", err)
+
+	// Load the Basic auth bypass credentials
+	basicAuth := config.BasicAuthBypass
+	var htpasswd *htpasswdStore
+	if basicAuth.HtpasswdFile != "" {
+		htpasswd, err = newHtpasswdStore(basicAuth.HtpasswdFile)
+		resources.check("basicAuthBypass.htpasswdFile", err)
+		if basicAuth.Realm == "" {
+			basicAuth.Realm = "Maintenance"
+		}
+	}
+
+	// Only track failed bypass attempts when a limit is configured
+	var tracker *failureTracker
+	if config.BypassMaxFailures > 0 {
+		window := time.Duration(config.BypassFailureWindow) * time.Second
+		if window <= 0 {
+			window = 5 * time.Minute
+		}
+		banDuration := time.Duration(config.BypassBanDuration) * time.Second
+		if banDuration <= 0 {
+			banDuration = 15 * time.Minute
+		}
+		maxClients := config.BypassBanMaxClients
+		if maxClients <= 0 {
+			maxClients = 10000
+		}
+		tracker = newFailureTracker(config.BypassMaxFailures, window, banDuration, maxClients)
 	}
 
 	// Create logger
@@ -133,47 +494,113 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		maintenanceFilePath: config.MaintenanceFilePath,
 		maintenanceContent:  config.MaintenanceContent,
 		bypassHeader:        config.BypassHeader,
-		bypassHeaderValue:   config.BypassHeaderValue,
+		bypassSecrets:       bypassSecrets,
 		enabled:             config.Enabled,
 		statusCode:          statusCode,
 		bypassPaths:         config.BypassPaths,
 		bypassFavicon:       config.BypassFavicon,
+		failureTracker:      tracker,
+		bypassQueryParam:    config.BypassQueryParam,
+		bypassCookieName:    bypassCookieName,
+		bypassCookieMaxAge:  bypassCookieMaxAge,
+		jwtVerifier:         verifier,
+		htpasswd:            htpasswd,
+		basicAuth:           basicAuth,
 		name:                name,
 		logger:              logger,
 		logLevel:            LogLevel(config.LogLevel),
-		contentType:         contentType,
+		contentType:         compiled.contentType,
+		trafficPercentage:   trafficPercentage,
+		trafficKey:          compiled.trafficKey,
+		drainEnabled:        config.DrainMode,
+		drainSessionCookies: config.DrainSessionCookies,
+		drainGracePeriod:    drainGracePeriod,
+		drainStart:          drainStart,
+		drainStartTime:      config.DrainStartTime,
+		drainKey:            drainKey,
+		webSocketPolicy:     compiled.webSocketPolicy,
+		ssePolicy:           compiled.ssePolicy,
+		streamStatusCode:    streamStatusCode,
+		rateLimiter:         limiter,
+		rules:               compiled.rules,
+		userAgentPolicies:   compiled.userAgentPolicies,
+		maintenancePaths:    compiled.maintenancePaths,
+		cors:                config.CORS,
+		stateFile:           groupState,
+		requestIDHeader:     requestIDHeader,
+		responseHeaders:     config.ResponseHeaders,
+		maintenanceEndTime:  compiled.maintenanceEndTime,
+		redirectReturnTo:    config.RedirectReturnTo,
+		apiPaths:            compiled.apiPaths,
+	}
+
+	for _, warning := range warnings {
+		m.log(LogLevelError, "Configuration warning: %s", warning)
 	}
 
 	// If maintenance file path is specified, try to read it initially
 	if config.MaintenanceFilePath != "" {
-		err := m.loadMaintenanceFile()
-		if err != nil {
-			return nil, fmt.Errorf("failed to load maintenance file: %w", err)
+		m.maintenanceFileMaxSize = int64(config.MaintenanceFileMaxSize)
+		if m.maintenanceFileMaxSize == 0 {
+			m.maintenanceFileMaxSize = defaultMaintenanceFileMaxSize
+		}
+		m.maintenanceFileBaseDir = config.MaintenanceFileBaseDir
+		if m.maintenanceFileBaseDir == "" {
+			m.maintenanceFileBaseDir = filepath.Dir(config.MaintenanceFilePath)
 		}
+		m.rejectSymlinks = config.MaintenanceFileRejectSymlinks
+
+		resources.check("maintenanceFilePath", m.loadMaintenanceFile())
 	} else if config.MaintenanceContent != "" {
 		// If direct content is provided, use that
 		m.log(LogLevelInfo, "Using provided maintenance content (%d bytes)", len(config.MaintenanceContent))
 	} else if config.MaintenanceService != "" {
-		// Validate maintenance service URL
-		maintenanceURL, err := url.Parse(config.MaintenanceService)
-		if err != nil {
-			return nil, fmt.Errorf("invalid maintenance service URL: %w", err)
-		}
-
-		if maintenanceURL.Scheme == "" || maintenanceURL.Host == "" {
-			return nil, fmt.Errorf("maintenance service URL must include scheme and host")
-		}
-
 		// Set default timeout if not specified
 		timeout := time.Duration(config.MaintenanceTimeout) * time.Second
 		if timeout == 0 {
 			timeout = 10 * time.Second
 		}
 
-		m.maintenanceService = maintenanceURL
+		m.maintenanceService = compiled.maintenanceService
 		m.timeout = timeout
+		m.proxyRequestHeaders = config.ProxyRequestHeaders
+		m.proxyResponseHeaders = config.ProxyResponseHeaders
+		m.proxyForwardCredentials = config.ProxyForwardCredentials
+	} else if config.RedirectURL != "" {
+		m.redirectURL = compiled.redirectURL
+		m.redirectStatusCode = compiled.redirectStatusCode
 	} else {
-		return nil, fmt.Errorf("either maintenanceService, maintenanceFilePath, or maintenanceContent must be specified")
+		// Without a content source, fall back to the built-in page
+		m.defaultPage = compiled.defaultPage
+		m.log(LogLevelInfo, "No maintenance content configured, using the built-in page")
+	}
+
+	if len(resources.errors) > 0 {
+		return nil, &ConfigError{Problems: resources.errors}
+	}
+
+	// Start from the group's shared state when one has been written. Picking up the state
+	// at startup isn't a change, so webhooks are only attached afterwards.
+	m.refreshState()
+
+	if compiled.webhooks != nil && config.NotifyWebhooks {
+		m.webhooks = compiled.webhooks
+		go compiled.webhooks.run(ctx, m)
+	}
+
+	// A configuration reload switching Enabled is a change like any other. With a state file, Redis
+	// or Consul the configured state is only a fallback, so changing it is not announced.
+	previousEnabled, reloaded := swapConfiguredState(name, config.Enabled)
+	if reloaded && previousEnabled != config.Enabled && config.StateFile == "" && compiled.redisState == nil && compiled.consulState == nil {
+		m.log(LogLevelInfo, "Maintenance mode %s by configuration", enabledLabel(config.Enabled))
+		m.notifyStateChange(config.Enabled, "configuration")
+	}
+
+	if compiled.redisState != nil {
+		go compiled.redisState.run(ctx, m)
+	}
+	if compiled.consulState != nil {
+		go compiled.consulState.run(ctx, m)
 	}
 
 	return m, nil
@@ -184,19 +611,21 @@ func (m *MaintenanceBypass) loadMaintenanceFile() error {
 	m.fileMutex.Lock()
 	defer m.fileMutex.Unlock()
 
-	fileInfo, err := os.Stat(m.maintenanceFilePath)
+	// Check the symlink and base directory restrictions on every reload, since the file may be swapped
+	resolved, fileInfo, err := resolveMaintenanceFile(m.maintenanceFilePath, m.maintenanceFileBaseDir, m.rejectSymlinks)
 	if err != nil {
-		return fmt.Errorf("error accessing maintenance file: %w", err)
+		return err
 	}
 
 	// Only reload if file is newer than our last modification time
 	if m.maintenanceFileContent != nil && !fileInfo.ModTime().After(m.maintenanceFileLastMod) {
+		m.maintenanceFileError = ""
 		return nil
 	}
 
-	content, err := ioutil.ReadFile(m.maintenanceFilePath)
+	content, err := readMaintenanceFile(resolved, m.maintenanceFileMaxSize)
 	if err != nil {
-		return fmt.Errorf("error reading maintenance file: %w", err)
+		return err
 	}
 
 	// Check if the file is empty
@@ -206,6 +635,7 @@ func (m *MaintenanceBypass) loadMaintenanceFile() error {
 
 	m.maintenanceFileContent = content
 	m.maintenanceFileLastMod = fileInfo.ModTime()
+	m.maintenanceFileError = ""
 	m.log(LogLevelInfo, "Loaded maintenance file: %s (%d bytes)", m.maintenanceFilePath, len(content))
 
 	return nil
@@ -220,16 +650,40 @@ func (m *MaintenanceBypass) log(level LogLevel, format string, v ...interface{})
 
 // ServeHTTP implements the http.Handler interface.
 func (m *MaintenanceBypass) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// Give the request an ID so its log lines and maintenance response can be matched
+	m.ensureRequestID(req)
+
 	// If maintenance mode is disabled, simply pass to the next handler
-	if !m.enabled {
-		m.log(LogLevelDebug, "Maintenance mode is disabled, passing request through: %s", req.URL.String())
+	if !m.isEnabled() {
+		m.logRequest(req, LogLevelDebug, "Maintenance mode is disabled, passing request through: %s", req.URL.String())
+		m.issueDrainMarker(rw, req)
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Only the configured sections are in maintenance, everything else passes through
+	if !m.inMaintenanceSection(req) {
+		m.logRequest(req, LogLevelDebug, "Request path %s is outside the maintenance paths, passing through", req.URL.Path)
 		m.next.ServeHTTP(rw, req)
 		return
 	}
 
+	// Clients banned for guessing the bypass value can't use any bypass mechanism
+	if m.isBypassBanned(clientIP(req)) {
+		m.logRequest(req, LogLevelDebug, "Client %s is banned from bypassing maintenance", clientIP(req))
+		m.serveMaintenance(rw, req)
+		return
+	}
+
+	// Declarative rules take precedence over the built-in checks
+	if rule := m.matchRule(req); rule != nil {
+		m.applyRule(rw, req, rule)
+		return
+	}
+
 	// Check if the request is for favicon.ico and should bypass
 	if m.bypassFavicon && strings.HasSuffix(req.URL.Path, "/favicon.ico") {
-		m.log(LogLevelDebug, "Request is for favicon.ico, bypassing maintenance mode: %s", req.URL.String())
+		m.logRequest(req, LogLevelDebug, "Request is for favicon.ico, bypassing maintenance mode: %s", req.URL.String())
 		m.next.ServeHTTP(rw, req)
 		return
 	}
@@ -237,40 +691,160 @@ func (m *MaintenanceBypass) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 	// Check if the request path is in the bypass paths list
 	for _, path := range m.bypassPaths {
 		if strings.HasPrefix(req.URL.Path, path) {
-			m.log(LogLevelDebug, "Request path %s matches bypass path %s, passing through", req.URL.Path, path)
+			m.logRequest(req, LogLevelDebug, "Request path %s matches bypass path %s, passing through", req.URL.Path, path)
 			m.next.ServeHTTP(rw, req)
 			return
 		}
 	}
 
-	// Check if the request has the bypass header with the correct value
-	headerValue := req.Header.Get(m.bypassHeader)
-	if headerValue == m.bypassHeaderValue {
-		// If the bypass header is present with the correct value, pass the request to the next handler
-		m.log(LogLevelDebug, "Bypass header found with value %s, passing to next handler", headerValue)
+	// Check if the request has the bypass header with an accepted value
+	if label, ok := m.matchBypassHeader(req); ok {
+		// If the bypass header is present with an accepted value, pass the request to the next handler
+		m.logRequest(req, LogLevelInfo, "Bypass header matched value %q, passing to next handler", label)
+		m.next.ServeHTTP(rw, req)
+		return
+	} else if m.bypassHeader != "" && req.Header.Get(m.bypassHeader) != "" {
+		m.recordBypassFailure(req, "header")
+	}
+
+	// Exchange a valid bypass query parameter for a cookie, then honour the cookie
+	if m.handleBypassQuery(rw, req) {
+		return
+	}
+	if label, ok := m.matchBypassCookie(req); ok {
+		m.logRequest(req, LogLevelInfo, "Bypass cookie for value %q accepted, passing to next handler", label)
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Check if the request carries a valid bypass token
+	if subject, ok := m.matchJWTBypass(req); ok {
+		m.logRequest(req, LogLevelDebug, "Bypass token accepted for subject %q, passing to next handler", subject)
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Check if the request carries valid Basic credentials, answering the login path with a challenge
+	user, authenticated := m.matchBasicAuthBypass(req)
+	if m.basicAuth.LoginPath != "" && req.URL.Path == m.basicAuth.LoginPath {
+		m.serveBasicAuthChallenge(rw, req, authenticated)
+		return
+	}
+	if authenticated {
+		m.logRequest(req, LogLevelDebug, "Basic credentials accepted for user %q, passing to next handler", user)
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Let existing sessions finish while draining
+	if m.isDraining(req) {
+		m.logRequest(req, LogLevelDebug, "Request %s belongs to an existing session, passing through while draining", req.URL.String())
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Only send the configured share of clients to the maintenance page
+	if !m.inMaintenanceRollout(req) {
+		m.logRequest(req, LogLevelDebug, "Request %s is outside the %d%% maintenance rollout, passing through", req.URL.String(), m.trafficPercentage)
 		m.next.ServeHTTP(rw, req)
 		return
 	}
 
-	m.log(LogLevelInfo, "No bypass condition met for %s, serving maintenance page", req.URL.String())
+	// Give crawlers and monitors their own response
+	if policy := m.matchUserAgentPolicy(req); policy != nil {
+		m.logRequest(req, LogLevelDebug, "User agent policy %q matched %s, action %s", policy.name, req.URL.String(), policy.action)
+
+		switch policy.action {
+		case UserAgentActionBypass:
+			m.next.ServeHTTP(rw, req)
+			return
+		case UserAgentActionMinimal:
+			req, span := m.startMaintenanceSpan(req)
+			decision := "user_agent_minimal"
+			if !m.serveMinimalMaintenance(rw, req, policy.statusCode) {
+				decision = "rate_limited"
+			}
+			m.endMaintenanceSpan(req, span, decision)
+			return
+		}
+	}
+
+	m.serveMaintenance(rw, req)
+}
+
+// serveMaintenance serves the maintenance response to a request no bypass condition applies to
+func (m *MaintenanceBypass) serveMaintenance(rw http.ResponseWriter, req *http.Request) {
+	// Record the decision as a span of the request's trace
+	req, span := m.startMaintenanceSpan(req)
+	decision := "maintenance"
+	defer func() {
+		m.endMaintenanceSpan(req, span, decision)
+	}()
+	rw = m.withResponseHeaders(rw, req)
+	m.setResponseRequestID(rw, req)
+
+	// Answer CORS preflights and let other origins read the maintenance response
+	if m.handlePreflight(rw, req) {
+		decision = "preflight"
+		return
+	}
+	m.applyCORSHeaders(rw, req)
+
+	// Apply the stream policies to WebSocket upgrades and Server-Sent Events
+	if m.handleStreamRequest(rw, req) {
+		decision = "stream"
+		return
+	}
+
+	// Protect Traefik from clients hammering the maintenance response
+	if m.rateLimited(rw, req) {
+		decision = "rate_limited"
+		return
+	}
+
+	m.logRequest(req, LogLevelInfo, "No bypass condition met for %s, serving maintenance page", req.URL.String())
 
 	// Set appropriate response headers for maintenance mode
-	rw.Header().Set("Retry-After", "3600") // Suggest client retry after 1 hour
+	rw.Header().Set("Retry-After", strconv.Itoa(m.retryAfterSeconds(time.Now())))
 	rw.Header().Set("X-Maintenance-Mode", "true")
 
+	// If the request's section has its own content, serve that
+	if section := m.matchMaintenancePath(req); section != nil && section.content != nil {
+		decision = "section"
+		m.serveMaintenanceSection(rw, req, section)
+		return
+	}
+
+	// If we have a redirect target configured, send clients there
+	if m.redirectURL != nil {
+		decision = "redirect"
+		m.serveMaintenanceRedirect(rw, req)
+		return
+	}
+
 	// If we have a maintenance file configured, serve that
 	if m.maintenanceFilePath != "" {
+		decision = "file"
 		m.serveMaintenanceFile(rw, req)
 		return
 	}
 
 	// If we have direct content configured, serve that
 	if m.maintenanceContent != "" {
+		decision = "content"
 		m.serveMaintenanceContent(rw, req)
 		return
 	}
 
+	// If no content source is configured, serve the built-in page
+	if m.defaultPage != nil {
+		decision = "default"
+		m.serveDefaultPage(rw, req)
+		return
+	}
+
 	// Otherwise, proxy to the maintenance service
+	decision = "service"
 	m.proxyToMaintenanceService(rw, req)
 }
 
@@ -278,26 +852,50 @@ func (m *MaintenanceBypass) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 func (m *MaintenanceBypass) serveMaintenanceFile(rw http.ResponseWriter, req *http.Request) {
 	// Try to reload the file if it's changed (check file modification time)
 	err := m.loadMaintenanceFile()
-	if err != nil {
-		m.log(LogLevelError, "Failed to load maintenance file: %v", err)
-		rw.Header().Set("X-Maintenance-Mode", "true")
-		http.Error(rw, "Service Temporarily Unavailable", m.statusCode)
-		return
-	}
 
 	// Read the content from our cache
 	m.fileMutex.RLock()
 	content := m.maintenanceFileContent
 	m.fileMutex.RUnlock()
 
+	// Keep serving the last good content when the reload fails. Failures are logged once
+	// until the error changes, but every stale response is marked.
+	if err != nil {
+		newError := m.recordMaintenanceFileError(err)
+		if content == nil {
+			if newError {
+				m.logRequest(req, LogLevelError, "Failed to load maintenance file: %v", err)
+			}
+			rw.Header().Set("X-Maintenance-Mode", "true")
+			http.Error(rw, "Service Temporarily Unavailable", m.maintenanceStatusCode(req))
+			return
+		}
+		if newError {
+			m.logRequest(req, LogLevelError, "Failed to reload maintenance file, serving the last good content: %v", err)
+		}
+		rw.Header().Set(staleContentHeader, "true")
+	}
+
 	// Set content type and other headers
 	rw.Header().Set("Content-Type", m.contentType)
 	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	rw.Header().Set("X-Maintenance-Mode", "true")
 
 	// Write the status code and content
-	rw.WriteHeader(m.statusCode)
-	rw.Write(content)
+	writeMaintenanceBody(rw, req, m.maintenanceStatusCode(req), renderMaintenanceBody(req, content))
+}
+
+// recordMaintenanceFileError remembers a failure to load the maintenance file, reporting
+// whether it differs from the previous one
+func (m *MaintenanceBypass) recordMaintenanceFileError(err error) bool {
+	m.fileMutex.Lock()
+	defer m.fileMutex.Unlock()
+
+	if m.maintenanceFileError == err.Error() {
+		return false
+	}
+	m.maintenanceFileError = err.Error()
+	return true
 }
 
 // serveMaintenanceContent serves the direct maintenance content from configuration
@@ -308,16 +906,26 @@ func (m *MaintenanceBypass) serveMaintenanceContent(rw http.ResponseWriter, req
 	rw.Header().Set("X-Maintenance-Mode", "true")
 
 	// Write the status code and content
-	rw.WriteHeader(m.statusCode)
-	rw.Write([]byte(m.maintenanceContent))
+	writeMaintenanceBody(rw, req, m.maintenanceStatusCode(req), renderMaintenanceBody(req, []byte(m.maintenanceContent)))
+}
+
+// writeMaintenanceBody writes the status code and body with its Content-Length.
+// HEAD requests get the same headers without the body.
+func writeMaintenanceBody(rw http.ResponseWriter, req *http.Request, statusCode int, body []byte) {
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(statusCode)
+	if req.Method != http.MethodHead {
+		rw.Write(body)
+	}
 }
 
 // proxyToMaintenanceService proxies the request to the maintenance service
 func (m *MaintenanceBypass) proxyToMaintenanceService(rw http.ResponseWriter, req *http.Request) {
 	// Create a custom response writer that will set our status code
+	statusCode := m.maintenanceStatusCode(req)
 	maintenanceWriter := &maintenanceResponseWriter{
 		ResponseWriter: rw,
-		statusCode:     m.statusCode,
+		statusCode:     statusCode,
 	}
 
 	// Create a reverse proxy to the maintenance service
@@ -328,11 +936,14 @@ func (m *MaintenanceBypass) proxyToMaintenanceService(rw http.ResponseWriter, re
 		ResponseHeaderTimeout: m.timeout,
 	}
 
+	// Rewrite the headers returned by the maintenance service
+	proxy.ModifyResponse = m.rewriteProxyResponseHeaders
+
 	// Handle errors from the maintenance service
 	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		m.log(LogLevelError, "Error proxying to maintenance service: %v", err)
+		m.logRequest(req, LogLevelError, "Error proxying to maintenance service: %v", err)
 		rw.Header().Set("X-Maintenance-Mode", "true")
-		rw.WriteHeader(m.statusCode)
+		rw.WriteHeader(statusCode)
 		rw.Write([]byte("Service temporarily unavailable"))
 	}
 
@@ -344,6 +955,10 @@ func (m *MaintenanceBypass) proxyToMaintenanceService(rw http.ResponseWriter, re
 	proxyReq.URL.Scheme = m.maintenanceService.Scheme
 	proxyReq.Host = m.maintenanceService.Host
 
+	// Continue the trace, then strip credentials and apply the configured header rules
+	propagateTraceContext(proxyReq, req)
+	m.rewriteProxyRequestHeaders(proxyReq, req)
+
 	// Proxy the request to the maintenance service with our custom writer
 	proxy.ServeHTTP(maintenanceWriter, proxyReq)
 }
@@ -355,8 +970,14 @@ type maintenanceResponseWriter struct {
 	headerSet  bool
 }
 
-// WriteHeader overrides the original WriteHeader to set our status code
+// WriteHeader overrides the original WriteHeader to set our status code.
+// Informational responses such as 101 Switching Protocols are passed through unchanged.
 func (w *maintenanceResponseWriter) WriteHeader(statusCode int) {
+	if statusCode >= 100 && statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
 	if !w.headerSet {
 		w.ResponseWriter.WriteHeader(w.statusCode)
 		w.headerSet = true
@@ -370,3 +991,18 @@ func (w *maintenanceResponseWriter) Write(b []byte) (int, error) {
 	}
 	return w.ResponseWriter.Write(b)
 }
+
+// Flush sends any buffered data to the client
+func (w *maintenanceResponseWriter) Flush() {
+	if !w.headerSet {
+		w.WriteHeader(w.statusCode)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original response writer so upgraded connections can be hijacked
+func (w *maintenanceResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
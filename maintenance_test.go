@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -719,14 +720,14 @@ func TestConfigValidation(t *testing.T) {
 			shouldHaveErr: false,
 		},
 		{
-			name: "Invalid config with no maintenance option",
+			name: "Valid config with no maintenance option uses the built-in page",
 			config: &Config{
 				MaintenanceService:  "",
 				MaintenanceFilePath: "",
 				MaintenanceContent:  "",
 				Enabled:             true,
 			},
-			shouldHaveErr: true,
+			shouldHaveErr: false,
 		},
 		{
 			name: "Invalid config with non-existent file",
@@ -813,6 +814,14 @@ func TestCreateConfig(t *testing.T) {
 	if config.ContentType != "text/html; charset=utf-8" {
 		t.Errorf("Expected default ContentType to be 'text/html; charset=utf-8', got %q", config.ContentType)
 	}
+
+	if config.TrafficPercentage != 100 {
+		t.Errorf("Expected default TrafficPercentage to be 100, got %d", config.TrafficPercentage)
+	}
+
+	if config.TrafficKey != "ip" {
+		t.Errorf("Expected default TrafficKey to be 'ip', got %q", config.TrafficKey)
+	}
 }
 
 // TestLoadMaintenanceFileErrors tests the error handling in loadMaintenanceFile
@@ -1331,3 +1340,48 @@ func TestMaintenanceContent(t *testing.T) {
 		t.Errorf("Expected body %q, got %q", "This is the real service content", string(body))
 	}
 }
+
+// TestHeadRequest tests that HEAD requests get the maintenance headers without a body
+func TestHeadRequest(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testContent := "<html><body>Maintenance</body></html>"
+	cfg := &Config{
+		MaintenanceContent: testContent,
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		t.Run(method, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, httptest.NewRequest(method, "http://example.com/", nil))
+
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+			}
+
+			if recorder.Header().Get("Content-Length") != strconv.Itoa(len(testContent)) {
+				t.Errorf("Expected Content-Length %d, got %q", len(testContent), recorder.Header().Get("Content-Length"))
+			}
+
+			if recorder.Header().Get("X-Maintenance-Mode") != "true" || recorder.Header().Get("Content-Type") == "" {
+				t.Errorf("Expected maintenance headers, got %v", recorder.Header())
+			}
+
+			expectedBody := testContent
+			if method == http.MethodHead {
+				expectedBody = ""
+			}
+			if recorder.Body.String() != expectedBody {
+				t.Errorf("Expected body %q, got %q", expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
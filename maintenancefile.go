@@ -0,0 +1,84 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaintenanceFileMaxSize bounds the maintenance page loaded into memory
+const defaultMaintenanceFileMaxSize = 1 << 20
+
+// staleContentHeader marks maintenance responses served from the last good copy of the file
+const staleContentHeader = "X-Maintenance-Stale"
+
+// resolveMaintenanceFile checks the maintenance file against the symlink and base directory
+// restrictions and returns the path of the regular file it resolves to
+func resolveMaintenanceFile(path, baseDir string, rejectSymlinks bool) (string, os.FileInfo, error) {
+	linkInfo, err := os.Lstat(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error accessing maintenance file: %w", err)
+	}
+	if rejectSymlinks && linkInfo.Mode()&os.ModeSymlink != 0 {
+		return "", nil, fmt.Errorf("maintenance file is a symlink: %s", path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error resolving maintenance file: %w", err)
+	}
+	base, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("error resolving maintenance file base directory: %w", err)
+	}
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil, fmt.Errorf("maintenance file %s resolves to %s, outside of %s", path, resolved, baseDir)
+	}
+
+	// Stat before opening, since opening a FIFO would block until something writes to it
+	fileInfo, err := os.Stat(resolved)
+	if err != nil {
+		return "", nil, fmt.Errorf("error accessing maintenance file: %w", err)
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("maintenance file is not a regular file: %s (%s)", path, fileInfo.Mode().Type())
+	}
+
+	return resolved, fileInfo, nil
+}
+
+// readMaintenanceFile reads a regular file of at most maxSize bytes
+func readMaintenanceFile(path string, maxSize int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading maintenance file: %w", err)
+	}
+	defer file.Close()
+
+	// The file may have been swapped between the checks and opening it
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading maintenance file: %w", err)
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return nil, fmt.Errorf("maintenance file is not a regular file: %s", path)
+	}
+	if fileInfo.Size() > maxSize {
+		return nil, fmt.Errorf("maintenance file is %d bytes, larger than the %d bytes limit: %s", fileInfo.Size(), maxSize, path)
+	}
+
+	// Read one byte past the limit to notice files growing while being read
+	content, err := ioutil.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading maintenance file: %w", err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("maintenance file is larger than the %d bytes limit: %s", maxSize, path)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,179 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMaintenanceFileRestrictions tests the size limit, symlink and base directory restrictions
+func TestMaintenanceFileRestrictions(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "maintenance-file-restrictions")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pageDir := filepath.Join(tmpDir, "pages")
+	dataDir := filepath.Join(pageDir, "..data")
+	outsideDir := filepath.Join(tmpDir, "outside")
+	for _, dir := range []string{dataDir, outsideDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	page := []byte("<html><body>Maintenance</body></html>")
+	writeFile := func(path string, content []byte) string {
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		return path
+	}
+	symlink := func(target, path string) string {
+		if err := os.Symlink(target, path); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+		return path
+	}
+
+	regular := writeFile(filepath.Join(pageDir, "regular.html"), page)
+	large := writeFile(filepath.Join(pageDir, "large.html"), []byte(strings.Repeat("x", 2048)))
+	writeFile(filepath.Join(dataDir, "configmap.html"), page)
+	secret := writeFile(filepath.Join(outsideDir, "secret.html"), page)
+	configMap := symlink(filepath.Join("..data", "configmap.html"), filepath.Join(pageDir, "configmap.html"))
+	escaping := symlink(secret, filepath.Join(pageDir, "escaping.html"))
+
+	testCases := []struct {
+		name    string
+		config  *Config
+		wantErr string
+	}{
+		{"Regular file", &Config{MaintenanceFilePath: regular}, ""},
+		{"File larger than the limit", &Config{MaintenanceFilePath: large, MaintenanceFileMaxSize: 1024}, "larger than the 1024 bytes limit"},
+		{"File within a raised limit", &Config{MaintenanceFilePath: large, MaintenanceFileMaxSize: 4096}, ""},
+		{"Symlink within the directory", &Config{MaintenanceFilePath: configMap}, ""},
+		{"Symlinks rejected", &Config{MaintenanceFilePath: configMap, MaintenanceFileRejectSymlinks: true}, "is a symlink"},
+		{"Symlink leaving the directory", &Config{MaintenanceFilePath: escaping}, "outside of"},
+		{"Symlink within a wider base directory", &Config{MaintenanceFilePath: escaping, MaintenanceFileBaseDir: tmpDir}, ""},
+		{"File outside the base directory", &Config{MaintenanceFilePath: regular, MaintenanceFileBaseDir: outsideDir}, "outside of"},
+		{"Directory", &Config{MaintenanceFilePath: dataDir, MaintenanceFileBaseDir: tmpDir}, "not a regular file"},
+	}
+
+	if _, err := os.Stat(os.DevNull); err == nil && os.DevNull == "/dev/null" {
+		testCases = append(testCases, struct {
+			name    string
+			config  *Config
+			wantErr string
+		}{"Device", &Config{MaintenanceFilePath: os.DevNull}, "not a regular file"})
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Enabled = true
+
+			_, err := New(context.Background(), http.NotFoundHandler(), tc.config, "maintenance-test")
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("Expected no error but got: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestMaintenanceFileStaleContent tests serving the last good content when a reload fails
+func TestMaintenanceFileStaleContent(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "maintenance-file-stale")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filePath := filepath.Join(tmpDir, "maintenance.html")
+	if err := ioutil.WriteFile(filePath, []byte("<p>First version</p>"), 0644); err != nil {
+		t.Fatalf("Failed to write maintenance file: %v", err)
+	}
+
+	cfg := &Config{
+		MaintenanceFilePath:    filePath,
+		MaintenanceFileMaxSize: 64,
+		LogLevel:               int(LogLevelError),
+		Enabled:                true,
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	m := middleware.(*MaintenanceBypass)
+	m.logger.SetOutput(logBuffer)
+
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		return recorder
+	}
+
+	// An oversized update keeps the first version
+	later := time.Now().Add(time.Minute)
+	if err := ioutil.WriteFile(filePath, []byte(strings.Repeat("x", 128)), 0644); err != nil {
+		t.Fatalf("Failed to update maintenance file: %v", err)
+	}
+	os.Chtimes(filePath, later, later)
+
+	recorder := serve()
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Body.String() != "<p>First version</p>" {
+		t.Errorf("Expected the last good content, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("X-Maintenance-Stale") != "true" {
+		t.Errorf("Expected the stale content header")
+	}
+	if !strings.Contains(logBuffer.String(), "Failed to reload maintenance file") {
+		t.Errorf("Expected the reload failure to be logged, got %q", logBuffer.String())
+	}
+
+	// A failure that persists is logged once, but every response is marked stale
+	for i := 0; i < 3; i++ {
+		if recorder := serve(); recorder.Header().Get("X-Maintenance-Stale") != "true" {
+			t.Errorf("Expected the stale content header on every response")
+		}
+	}
+	if count := strings.Count(logBuffer.String(), "Failed to reload maintenance file"); count != 1 {
+		t.Errorf("Expected the reload failure to be logged once, got %d times", count)
+	}
+
+	// A valid update is picked up and the content is no longer stale
+	later = later.Add(time.Minute)
+	if err := ioutil.WriteFile(filePath, []byte("<p>Second version</p>"), 0644); err != nil {
+		t.Fatalf("Failed to update maintenance file: %v", err)
+	}
+	os.Chtimes(filePath, later, later)
+
+	recorder = serve()
+	if recorder.Body.String() != "<p>Second version</p>" || recorder.Header().Get("X-Maintenance-Stale") != "" {
+		t.Errorf("Expected the updated content without the stale header, got %q %v", recorder.Body.String(), recorder.Header())
+	}
+}
+
+// TestMaintenanceContentSizeLimit tests that inline content is subject to the same size limit
+func TestMaintenanceContentSizeLimit(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent:     strings.Repeat("x", 100),
+		MaintenanceFileMaxSize: 50,
+		Enabled:                true,
+	}
+
+	if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err == nil {
+		t.Errorf("Expected error for oversized content but got none")
+	}
+}
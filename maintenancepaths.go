@@ -0,0 +1,106 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MaintenancePath puts a section of the application in maintenance. When any are configured,
+// only matching requests get the maintenance response and everything else passes through.
+type MaintenancePath struct {
+	// Path matches the request path: a prefix, "exact:<path>" or "regex:<expression>"
+	Path string `json:"path,omitempty"`
+
+	// Content is the body served for the section. Defaults to the middleware's maintenance response.
+	Content string `json:"content,omitempty"`
+
+	// ContentType is the content type of Content. Defaults to ContentType.
+	ContentType string `json:"contentType,omitempty"`
+
+	// StatusCode is the status of the section's maintenance response. Defaults to StatusCode.
+	StatusCode int `json:"statusCode,omitempty"`
+}
+
+// compiledMaintenancePath is a maintenance section ready to be evaluated
+type compiledMaintenancePath struct {
+	pattern     string
+	matcher     pathMatcher
+	content     []byte
+	contentType string
+	statusCode  int
+}
+
+// compileMaintenancePaths compiles the configured sections, applying the middleware defaults.
+// Problems are recorded on v with the index of the section.
+func compileMaintenancePaths(v *configValidator, paths []MaintenancePath, statusCode int, contentType string) []compiledMaintenancePath {
+	compiled := make([]compiledMaintenancePath, 0, len(paths))
+
+	for i, path := range paths {
+		field := fmt.Sprintf("maintenancePaths[%d]", i)
+		v.statusCode(field+".statusCode", path.StatusCode)
+
+		if path.Path == "" {
+			v.fail(field+".path", "must not be empty")
+			continue
+		}
+
+		matcher, err := compilePathPattern(path.Path)
+		if err != nil {
+			v.check(field+".path", err)
+			continue
+		}
+
+		section := compiledMaintenancePath{
+			pattern:     path.Path,
+			matcher:     matcher,
+			contentType: path.ContentType,
+			statusCode:  path.StatusCode,
+		}
+		if path.Content != "" {
+			section.content = []byte(path.Content)
+		}
+		if section.contentType == "" {
+			section.contentType = contentType
+		}
+		if section.statusCode == 0 {
+			section.statusCode = statusCode
+		}
+
+		compiled = append(compiled, section)
+	}
+
+	return compiled
+}
+
+// matchMaintenancePath returns the first section matching the request path, or nil
+func (m *MaintenanceBypass) matchMaintenancePath(req *http.Request) *compiledMaintenancePath {
+	for i := range m.maintenancePaths {
+		if m.maintenancePaths[i].matcher.matchPath(req.URL.Path) {
+			return &m.maintenancePaths[i]
+		}
+	}
+	return nil
+}
+
+// inMaintenanceSection reports whether the request falls in a section under maintenance.
+// Without configured sections the whole application is under maintenance.
+func (m *MaintenanceBypass) inMaintenanceSection(req *http.Request) bool {
+	return len(m.maintenancePaths) == 0 || m.matchMaintenancePath(req) != nil
+}
+
+// maintenanceStatusCode returns the status of the maintenance response for the request
+func (m *MaintenanceBypass) maintenanceStatusCode(req *http.Request) int {
+	if section := m.matchMaintenancePath(req); section != nil {
+		return section.statusCode
+	}
+	return m.statusCode
+}
+
+// serveMaintenanceSection serves the content configured for a section
+func (m *MaintenanceBypass) serveMaintenanceSection(rw http.ResponseWriter, req *http.Request, section *compiledMaintenancePath) {
+	rw.Header().Set("Content-Type", section.contentType)
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Header().Set("X-Maintenance-Mode", "true")
+
+	writeMaintenanceBody(rw, req, section.statusCode, renderMaintenanceBody(req, section.content))
+}
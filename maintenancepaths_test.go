@@ -0,0 +1,109 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMaintenancePaths tests putting only selected sections in maintenance
+func TestMaintenancePaths(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte("Application"))
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		MaintenancePaths: []MaintenancePath{
+			{
+				Path:        "/checkout",
+				Content:     `{"message":"Checkout is down for maintenance"}`,
+				ContentType: "application/json",
+				StatusCode:  http.StatusTooManyRequests,
+			},
+			{Path: "exact:/payments", StatusCode: http.StatusNotImplemented},
+			{Path: `regex:^/api/v\d+/orders`},
+		},
+		Enabled: true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	testCases := []struct {
+		name                string
+		path                string
+		bypass              bool
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+	}{
+		{"Section with its own content", "/checkout/cart", false, http.StatusTooManyRequests, "Checkout is down", "application/json"},
+		{"Section with its own status", "/payments", false, http.StatusNotImplemented, "Maintenance", "text/html; charset=utf-8"},
+		{"Exact section doesn't match sub paths", "/payments/history", false, http.StatusOK, "Application", ""},
+		{"Regex section with defaults", "/api/v2/orders/1", false, http.StatusServiceUnavailable, "Maintenance", "text/html; charset=utf-8"},
+		{"Path outside every section", "/products", false, http.StatusOK, "Application", ""},
+		{"Bypass still works inside a section", "/checkout", true, http.StatusOK, "Application", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+tc.path, nil)
+			if tc.bypass {
+				req.Header.Set("X-Maintenance-Bypass", "true")
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, recorder.Code)
+			}
+
+			if !strings.Contains(recorder.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tc.expectedBody, recorder.Body.String())
+			}
+
+			if tc.expectedContentType != "" && recorder.Header().Get("Content-Type") != tc.expectedContentType {
+				t.Errorf("Expected content type %q, got %q", tc.expectedContentType, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+// TestMaintenancePathsValidation tests that misconfigured sections are rejected
+func TestMaintenancePathsValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name string
+		path MaintenancePath
+	}{
+		{"Empty path", MaintenancePath{}},
+		{"Invalid regex", MaintenancePath{Path: "regex:("}},
+		{"Invalid status code", MaintenancePath{Path: "/checkout", StatusCode: 1000}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				MaintenancePaths:   []MaintenancePath{tc.path},
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
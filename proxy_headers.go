@@ -0,0 +1,86 @@
+package traefik_maintenance_warden
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderRules describes how headers are rewritten on their way to or from the maintenance service.
+// Rules are applied in order: Strip, then Set, then Add.
+type HeaderRules struct {
+	// Strip lists header names to remove
+	Strip []string `json:"strip,omitempty"`
+
+	// Set replaces the value of a header, creating it if missing
+	Set map[string]string `json:"set,omitempty"`
+
+	// Add appends a value to a header, keeping any existing values
+	Add map[string]string `json:"add,omitempty"`
+}
+
+// credentialHeaders are the request headers stripped before proxying to the maintenance
+// service unless ProxyForwardCredentials is enabled
+var credentialHeaders = []string{"Cookie", "Authorization", "Proxy-Authorization"}
+
+// apply rewrites the headers according to the rules, passing every value through expand
+func (r HeaderRules) apply(header http.Header, expand func(string) string) {
+	for _, name := range r.Strip {
+		header.Del(name)
+	}
+
+	for name, value := range r.Set {
+		header.Set(name, expand(value))
+	}
+
+	for name, value := range r.Add {
+		header.Add(name, expand(value))
+	}
+}
+
+// headerPlaceholders returns a function expanding request placeholders in header values.
+// Supported placeholders are {host}, {uri}, {path}, {method}, {scheme} and {remote_addr}.
+func headerPlaceholders(req *http.Request) func(string) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+
+	replacer := strings.NewReplacer(
+		"{host}", req.Host,
+		"{uri}", req.URL.RequestURI(),
+		"{path}", req.URL.Path,
+		"{method}", req.Method,
+		"{scheme}", scheme,
+		"{remote_addr}", req.RemoteAddr,
+	)
+
+	return func(value string) string {
+		if !strings.Contains(value, "{") {
+			return value
+		}
+		return replacer.Replace(value)
+	}
+}
+
+// noExpand returns header values unchanged
+func noExpand(value string) string {
+	return value
+}
+
+// rewriteProxyRequestHeaders prepares the headers of a request about to be sent to the maintenance service.
+// original is the request as received by the middleware and is only used for placeholder expansion.
+func (m *MaintenanceBypass) rewriteProxyRequestHeaders(proxyReq *http.Request, original *http.Request) {
+	if !m.proxyForwardCredentials {
+		for _, name := range credentialHeaders {
+			proxyReq.Header.Del(name)
+		}
+	}
+
+	m.proxyRequestHeaders.apply(proxyReq.Header, headerPlaceholders(original))
+}
+
+// rewriteProxyResponseHeaders rewrites the headers of a response received from the maintenance service
+func (m *MaintenanceBypass) rewriteProxyResponseHeaders(resp *http.Response) error {
+	m.proxyResponseHeaders.apply(resp.Header, noExpand)
+	return nil
+}
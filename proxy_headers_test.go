@@ -0,0 +1,158 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestProxyRequestHeaders tests that credentials are stripped and header rules are applied
+func TestProxyRequestHeaders(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name             string
+		forwardCreds     bool
+		rules            HeaderRules
+		expectedHeaders  map[string]string
+		forbiddenHeaders []string
+	}{
+		{
+			name:             "Credentials are stripped by default",
+			expectedHeaders:  map[string]string{"X-Custom": "custom"},
+			forbiddenHeaders: []string{"Cookie", "Authorization"},
+		},
+		{
+			name:         "Credentials are forwarded when enabled",
+			forwardCreds: true,
+			expectedHeaders: map[string]string{
+				"Cookie":        "session=abc",
+				"Authorization": "Bearer token",
+			},
+		},
+		{
+			name: "Strip, set and add rules with placeholders",
+			rules: HeaderRules{
+				Strip: []string{"X-Custom"},
+				Set: map[string]string{
+					"X-Original-Host": "{host}",
+					"X-Original-URI":  "{uri}",
+				},
+				Add: map[string]string{"X-Maintenance-Source": "warden"},
+			},
+			expectedHeaders: map[string]string{
+				"X-Original-Host":      "example.com",
+				"X-Original-URI":       "/shop/cart?item=1",
+				"X-Maintenance-Source": "warden",
+			},
+			forbiddenHeaders: []string{"X-Custom", "Cookie"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received http.Header
+			maintenanceServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				received = req.Header.Clone()
+				rw.WriteHeader(http.StatusOK)
+			}))
+			defer maintenanceServer.Close()
+
+			cfg := &Config{
+				MaintenanceService:      maintenanceServer.URL,
+				BypassHeader:            "X-Maintenance-Bypass",
+				BypassHeaderValue:       "true",
+				Enabled:                 true,
+				ProxyRequestHeaders:     tc.rules,
+				ProxyForwardCredentials: tc.forwardCreds,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/shop/cart?item=1", nil)
+			req.Header.Set("Cookie", "session=abc")
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("X-Custom", "custom")
+
+			middleware.ServeHTTP(httptest.NewRecorder(), req)
+
+			if received == nil {
+				t.Fatalf("Maintenance service was not called")
+			}
+
+			for name, value := range tc.expectedHeaders {
+				if received.Get(name) != value {
+					t.Errorf("Expected header %s to be %q, got %q", name, value, received.Get(name))
+				}
+			}
+
+			for _, name := range tc.forbiddenHeaders {
+				if received.Get(name) != "" {
+					t.Errorf("Expected header %s to be stripped, got %q", name, received.Get(name))
+				}
+			}
+
+			// The original request must keep its credentials
+			if req.Header.Get("Cookie") != "session=abc" {
+				t.Errorf("Original request headers were modified")
+			}
+		})
+	}
+}
+
+// TestProxyResponseHeaders tests that response header rules are applied to the maintenance service response
+func TestProxyResponseHeaders(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	maintenanceServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Set-Cookie", "tracking=1")
+		rw.Header().Set("Server", "maintenance/1.0")
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer maintenanceServer.Close()
+
+	cfg := &Config{
+		MaintenanceService: maintenanceServer.URL,
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		Enabled:            true,
+		ProxyResponseHeaders: HeaderRules{
+			Strip: []string{"Set-Cookie"},
+			Set:   map[string]string{"Server": "warden"},
+			Add:   map[string]string{"X-Robots-Tag": "noindex"},
+		},
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	resp := recorder.Result()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	if resp.Header.Get("Set-Cookie") != "" {
+		t.Errorf("Expected Set-Cookie to be stripped, got %q", resp.Header.Get("Set-Cookie"))
+	}
+
+	if resp.Header.Get("Server") != "warden" {
+		t.Errorf("Expected Server header to be 'warden', got %q", resp.Header.Get("Server"))
+	}
+
+	if resp.Header.Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("Expected X-Robots-Tag header to be 'noindex', got %q", resp.Header.Get("X-Robots-Tag"))
+	}
+}
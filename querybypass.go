@@ -0,0 +1,121 @@
+package traefik_maintenance_warden
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signBypassCookie creates a cookie value proving the client presented a valid bypass key.
+// The value never contains the key itself: it carries the label and expiry, signed with the
+// digest of the matching key, so revoking a key also revokes the cookies it issued.
+func signBypassCookie(secret bypassSecret, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(secret.label)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, secret.digest[:])
+	mac.Write([]byte(payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyBypassCookie checks a bypass cookie, returning the label of the key that issued it
+func (m *MaintenanceBypass) verifyBypassCookie(value string, now time.Time) (string, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	labelBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	label := string(labelBytes)
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return "", false
+	}
+
+	signature, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return "", false
+	}
+
+	for _, secret := range m.bypassSecrets {
+		if secret.label != label {
+			continue
+		}
+		mac := hmac.New(sha256.New, secret.digest[:])
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return label, true
+		}
+	}
+
+	return "", false
+}
+
+// matchBypassCookie reports whether the request carries a valid bypass cookie
+func (m *MaintenanceBypass) matchBypassCookie(req *http.Request) (string, bool) {
+	if m.bypassQueryParam == "" {
+		return "", false
+	}
+
+	cookie, err := req.Cookie(m.bypassCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+
+	return m.verifyBypassCookie(cookie.Value, time.Now())
+}
+
+// handleBypassQuery upgrades a valid bypass query parameter to a cookie and redirects to the URL
+// without the parameter, so the key doesn't linger in browser history or analytics.
+// It returns true when a response has been written.
+func (m *MaintenanceBypass) handleBypassQuery(rw http.ResponseWriter, req *http.Request) bool {
+	if m.bypassQueryParam == "" {
+		return false
+	}
+
+	query := req.URL.Query()
+	value := query.Get(m.bypassQueryParam)
+	if value == "" {
+		return false
+	}
+
+	index, ok := m.matchBypassValue(value)
+	if !ok {
+		m.recordBypassFailure(req, "query parameter")
+		return false
+	}
+
+	secret := m.bypassSecrets[index]
+	expires := time.Now().Add(m.bypassCookieMaxAge)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     m.bypassCookieName,
+		Value:    signBypassCookie(secret, expires),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(m.bypassCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query.Del(m.bypassQueryParam)
+	// Keep the path escaped so encoded slashes survive, and collapse leading slashes so
+	// a path such as //evil.example isn't taken as a host by the browser
+	target := "/" + strings.TrimLeft(req.URL.EscapedPath(), "/")
+	if encoded := query.Encode(); encoded != "" {
+		target += "?" + encoded
+	}
+
+	m.logRequest(req, LogLevelInfo, "Bypass query parameter matched value %q, setting bypass cookie and redirecting", secret.label)
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(rw, req, target, http.StatusSeeOther)
+	return true
+}
@@ -0,0 +1,192 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBypassQueryParam tests exchanging the bypass query parameter for a cookie and using the cookie
+func TestBypassQueryParam(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValues: []BypassValue{
+			{Label: "qa-team", Value: "qa-secret"},
+		},
+		BypassQueryParam:  "preview",
+		BypassMaxFailures: 2,
+		Enabled:           true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	// A valid key sets the cookie and redirects to the URL without the parameter
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/shop?item=42&preview=qa-secret", nil)
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d", http.StatusSeeOther, recorder.Code)
+	}
+	if location := recorder.Header().Get("Location"); location != "/shop?item=42" {
+		t.Errorf("Expected redirect to /shop?item=42, got %q", location)
+	}
+
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "maintenance_bypass" {
+		t.Fatalf("Expected a maintenance_bypass cookie, got %v", cookies)
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != 3600 {
+		t.Errorf("Expected an HttpOnly, SameSite=Lax cookie lasting an hour, got %+v", cookie)
+	}
+	if strings.Contains(cookie.Value, "qa-secret") {
+		t.Errorf("Expected cookie not to contain the bypass key, got %q", cookie.Value)
+	}
+
+	// The cookie bypasses maintenance on later requests
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/shop?item=42", nil)
+	req.AddCookie(cookie)
+	recorder = httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected cookie to bypass maintenance, got status %d", recorder.Code)
+	}
+
+	// Tampered cookies are rejected
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	tampered := cookie.Value[:len(cookie.Value)-1] + "0"
+	if tampered == cookie.Value {
+		tampered = cookie.Value[:len(cookie.Value)-1] + "1"
+	}
+	req.AddCookie(&http.Cookie{Name: "maintenance_bypass", Value: tampered})
+	recorder = httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected tampered cookie to be rejected, got status %d", recorder.Code)
+	}
+
+	// Invalid keys are served the maintenance page and count towards a ban
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest(http.MethodGet, "http://example.com/?preview=guess", nil)
+		recorder = httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected invalid key to be served maintenance, got status %d", recorder.Code)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/?preview=qa-secret", nil)
+	recorder = httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected banned client to be served maintenance, got status %d", recorder.Code)
+	}
+}
+
+// TestBypassQueryParamRedirectTarget tests that the redirect stays on the site and keeps the escaped path
+func TestBypassQueryParamRedirectTarget(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValues: []BypassValue{{Label: "qa-team", Value: "qa-secret"}},
+		BypassQueryParam:   "preview",
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		requestURI       string
+		expectedLocation string
+	}{
+		{"Encoded slash is kept", "/files/a%2Fb?preview=qa-secret", "/files/a%2Fb"},
+		{"Protocol-relative path stays on the site", "//evil.example?preview=qa-secret", "/evil.example"},
+		{"Repeated leading slashes are collapsed", "///evil.example/path?preview=qa-secret", "/evil.example/path"},
+		{"Root path", "/?preview=qa-secret", "/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RequestURI = tc.requestURI
+			req.URL, err = url.ParseRequestURI(tc.requestURI)
+			if err != nil {
+				t.Fatalf("Error parsing request URI: %v", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if location := recorder.Header().Get("Location"); location != tc.expectedLocation {
+				t.Errorf("Expected redirect to %q, got %q", tc.expectedLocation, location)
+			}
+		})
+	}
+}
+
+// TestVerifyBypassCookie tests that only unexpired cookies signed by a configured key are accepted
+func TestVerifyBypassCookie(t *testing.T) {
+	middleware := &MaintenanceBypass{
+		bypassSecrets: []bypassSecret{{label: "qa-team", digest: [32]byte{1}}},
+	}
+	revoked := bypassSecret{label: "qa-team", digest: [32]byte{2}}
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{"Valid cookie", signBypassCookie(middleware.bypassSecrets[0], now.Add(time.Hour)), true},
+		{"Expired cookie", signBypassCookie(middleware.bypassSecrets[0], now.Add(-time.Second)), false},
+		{"Signed by a revoked key", signBypassCookie(revoked, now.Add(time.Hour)), false},
+		{"Malformed cookie", "not-a-cookie", false},
+		{"Empty cookie", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			label, ok := middleware.verifyBypassCookie(tc.value, now)
+			if ok != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, ok)
+			}
+			if ok && label != "qa-team" {
+				t.Errorf("Expected label qa-team, got %q", label)
+			}
+		})
+	}
+}
+
+// TestBypassQueryParamRequiresValues tests that the query parameter can't be enabled without accepted values
+func TestBypassQueryParamRequiresValues(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassQueryParam:   "preview",
+		Enabled:            true,
+	}
+
+	if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
@@ -0,0 +1,145 @@
+package traefik_maintenance_warden
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a classic token bucket refilled continuously at a fixed rate
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take consumes a token if one is available. When none is, it returns how long until the next token.
+func (b *tokenBucket) take(now time.Time, rate, burst float64) (bool, time.Duration) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// clientBucket is the per-client entry stored in the limiter's LRU list
+type clientBucket struct {
+	ip     string
+	bucket tokenBucket
+}
+
+// rateLimiter limits maintenance responses per client IP and globally. Client buckets are kept
+// in a bounded LRU so memory stays predictable when many distinct clients hit the maintenance page.
+type rateLimiter struct {
+	mutex       sync.Mutex
+	rate        float64
+	burst       float64
+	globalRate  float64
+	globalBurst float64
+	global      tokenBucket
+	maxClients  int
+	clients     map[string]*list.Element
+	lru         *list.List
+}
+
+// newRateLimiter creates a limiter. A zero rate disables the corresponding limit.
+func newRateLimiter(rate, burst, globalRate, globalBurst, maxClients int) *rateLimiter {
+	if burst < rate {
+		burst = rate
+	}
+	if globalBurst < globalRate {
+		globalBurst = globalRate
+	}
+
+	return &rateLimiter{
+		rate:        float64(rate),
+		burst:       float64(burst),
+		globalRate:  float64(globalRate),
+		globalBurst: float64(globalBurst),
+		maxClients:  maxClients,
+		clients:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// allow reports whether a maintenance response may be served to the client,
+// and otherwise how long the client should wait
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rate > 0 {
+		if ok, wait := l.clientBucket(ip).take(now, l.rate, l.burst); !ok {
+			return false, wait
+		}
+	}
+
+	if l.globalRate > 0 {
+		if ok, wait := l.global.take(now, l.globalRate, l.globalBurst); !ok {
+			return false, wait
+		}
+	}
+
+	return true, 0
+}
+
+// clientBucket returns the bucket of a client, evicting the least recently seen client when full
+func (l *rateLimiter) clientBucket(ip string) *tokenBucket {
+	if element, ok := l.clients[ip]; ok {
+		l.lru.MoveToFront(element)
+		return &element.Value.(*clientBucket).bucket
+	}
+
+	if l.lru.Len() >= l.maxClients {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.clients, oldest.Value.(*clientBucket).ip)
+	}
+
+	entry := &clientBucket{ip: ip}
+	l.clients[ip] = l.lru.PushFront(entry)
+	return &entry.bucket
+}
+
+// rateLimited applies the rate limiter to a maintenance response. It returns true when the
+// client is over the limit and a 429 response has already been written.
+func (m *MaintenanceBypass) rateLimited(rw http.ResponseWriter, req *http.Request) bool {
+	if m.rateLimiter == nil {
+		return false
+	}
+
+	ip := clientIP(req)
+	ok, wait := m.rateLimiter.allow(ip, time.Now())
+	if ok {
+		return false
+	}
+
+	m.logRequest(req, LogLevelDebug, "Rate limit exceeded for %s, retry in %v", ip, wait)
+	serveRateLimited(rw, wait)
+	return true
+}
+
+// serveRateLimited writes a minimal 429 response with a Retry-After derived from the wait time
+func serveRateLimited(rw http.ResponseWriter, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	rw.Header().Set("X-Maintenance-Mode", "true")
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusTooManyRequests)
+	rw.Write([]byte("Too Many Requests"))
+}
@@ -0,0 +1,158 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTokenBucket tests token consumption and refill
+func TestTokenBucket(t *testing.T) {
+	bucket := &tokenBucket{}
+	now := time.Now()
+
+	// A fresh bucket starts full
+	for i := 0; i < 3; i++ {
+		if ok, _ := bucket.take(now, 1, 3); !ok {
+			t.Fatalf("Expected token %d to be available", i+1)
+		}
+	}
+
+	ok, wait := bucket.take(now, 1, 3)
+	if ok {
+		t.Fatalf("Expected bucket to be empty")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Expected wait between 0 and 1s, got %v", wait)
+	}
+
+	// After a second one token has been refilled
+	if ok, _ := bucket.take(now.Add(time.Second), 1, 3); !ok {
+		t.Errorf("Expected token to be refilled after one second")
+	}
+}
+
+// TestRateLimiterEviction tests that the number of tracked clients is bounded
+func TestRateLimiterEviction(t *testing.T) {
+	limiter := newRateLimiter(1, 1, 0, 0, 2)
+	now := time.Now()
+
+	limiter.allow("10.0.0.1", now)
+	limiter.allow("10.0.0.2", now)
+	limiter.allow("10.0.0.1", now) // Refresh 10.0.0.1 so 10.0.0.2 is the oldest
+	limiter.allow("10.0.0.3", now)
+
+	if len(limiter.clients) != 2 || limiter.lru.Len() != 2 {
+		t.Fatalf("Expected 2 tracked clients, got %d", len(limiter.clients))
+	}
+
+	if _, ok := limiter.clients["10.0.0.2"]; ok {
+		t.Errorf("Expected least recently seen client to be evicted")
+	}
+
+	if _, ok := limiter.clients["10.0.0.1"]; !ok {
+		t.Errorf("Expected recently seen client to be kept")
+	}
+}
+
+// TestRateLimitedMaintenanceResponses tests the per-client and global limits on maintenance responses
+func TestRateLimitedMaintenanceResponses(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name          string
+		average       int
+		burst         int
+		globalAverage int
+		clients       int
+		requests      int
+		expectedOK    int
+	}{
+		{"Per client burst is enforced", 1, 2, 0, 1, 5, 2},
+		{"Per client limits are independent", 1, 2, 0, 3, 5, 6},
+		{"Global limit applies across clients", 0, 0, 3, 3, 5, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent:     "<html><body>Maintenance</body></html>",
+				BypassHeader:           "X-Maintenance-Bypass",
+				BypassHeaderValue:      "true",
+				Enabled:                true,
+				RateLimitAverage:       tc.average,
+				RateLimitBurst:         tc.burst,
+				RateLimitGlobalAverage: tc.globalAverage,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			served := 0
+			for client := 0; client < tc.clients; client++ {
+				for i := 0; i < tc.requests; i++ {
+					req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+					req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", client+1)
+
+					recorder := httptest.NewRecorder()
+					middleware.ServeHTTP(recorder, req)
+
+					resp := recorder.Result()
+					switch resp.StatusCode {
+					case http.StatusServiceUnavailable:
+						served++
+					case http.StatusTooManyRequests:
+						if resp.Header.Get("Retry-After") == "" {
+							t.Errorf("Expected Retry-After header on rate limited response")
+						}
+					default:
+						t.Errorf("Unexpected status code %d", resp.StatusCode)
+					}
+				}
+			}
+
+			if served != tc.expectedOK {
+				t.Errorf("Expected %d maintenance responses, got %d", tc.expectedOK, served)
+			}
+		})
+	}
+}
+
+// TestRateLimitSkipsBypassedRequests tests that bypassed requests are never rate limited
+func TestRateLimitSkipsBypassedRequests(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		Enabled:            true,
+		RateLimitAverage:   1,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("X-Maintenance-Bypass", "true")
+
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+
+		if recorder.Result().StatusCode != http.StatusOK {
+			t.Fatalf("Expected bypassed request %d to pass through, got %d", i+1, recorder.Result().StatusCode)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package traefik_maintenance_warden
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// validateRedirect parses the redirect target and checks the redirect status code
+func validateRedirect(target string, statusCode int) (*url.URL, int, error) {
+	redirectURL, err := url.Parse(target)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	if redirectURL.Scheme == "" || redirectURL.Host == "" {
+		return nil, 0, fmt.Errorf("redirect URL must include scheme and host")
+	}
+
+	switch statusCode {
+	case 0:
+		statusCode = http.StatusFound
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, 0, fmt.Errorf("redirect status code must be 301, 302, 303, 307 or 308, got %d", statusCode)
+	}
+
+	return redirectURL, statusCode, nil
+}
+
+// originalURL reconstructs the absolute URL the client requested
+func originalURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + req.Host + req.URL.RequestURI()
+}
+
+// isAPIRequest reports whether the request comes from an API or XHR client rather than a browser
+func (m *MaintenanceBypass) isAPIRequest(req *http.Request) bool {
+	for _, pattern := range m.apiPaths {
+		if pattern.matchPath(req.URL.Path) {
+			return true
+		}
+	}
+
+	accept := req.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// redirectTarget returns the redirect location, optionally carrying the original URL
+func (m *MaintenanceBypass) redirectTarget(req *http.Request) string {
+	if !m.redirectReturnTo {
+		return m.redirectURL.String()
+	}
+
+	target := *m.redirectURL
+	query := target.Query()
+	query.Set("returnTo", originalURL(req))
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
+
+// serveMaintenanceRedirect redirects browsers to the external status page. API clients get
+// a JSON body instead so XHR requests don't silently follow the redirect into HTML.
+func (m *MaintenanceBypass) serveMaintenanceRedirect(rw http.ResponseWriter, req *http.Request) {
+	target := m.redirectTarget(req)
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Header().Set("X-Maintenance-Mode", "true")
+
+	if m.isAPIRequest(req) {
+		statusCode := m.maintenanceStatusCode(req)
+		body, _ := json.Marshal(map[string]interface{}{
+			"maintenance": true,
+			"status":      statusCode,
+			"message":     "Service temporarily unavailable",
+			"statusPage":  target,
+			"traceId":     traceIDFromRequest(req),
+		})
+
+		rw.Header().Set("Content-Type", "application/json")
+		writeMaintenanceBody(rw, req, statusCode, body)
+		return
+	}
+
+	http.Redirect(rw, req, target, m.redirectStatusCode)
+}
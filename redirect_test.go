@@ -0,0 +1,149 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestMaintenanceRedirect tests redirecting browsers and answering API clients with JSON
+func TestMaintenanceRedirect(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name             string
+		statusCode       int
+		returnTo         bool
+		path             string
+		accept           string
+		expectedStatus   int
+		expectedLocation string
+		expectJSON       bool
+	}{
+		{
+			name:             "Browser is redirected with default status",
+			path:             "/shop",
+			accept:           "text/html,application/xhtml+xml",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://status.example.com/incident?src=warden",
+		},
+		{
+			name:             "Browser is redirected with custom status and returnTo",
+			statusCode:       http.StatusTemporaryRedirect,
+			returnTo:         true,
+			path:             "/shop?item=1",
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "https://status.example.com/incident?returnTo=" + url.QueryEscape("http://example.com/shop?item=1") + "&src=warden",
+		},
+		{
+			name:           "JSON client gets a JSON body",
+			path:           "/shop",
+			accept:         "application/json",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectJSON:     true,
+		},
+		{
+			name:           "API path gets a JSON body",
+			path:           "/api/orders",
+			accept:         "*/*",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectJSON:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				RedirectURL:        "https://status.example.com/incident?src=warden",
+				RedirectStatusCode: tc.statusCode,
+				RedirectReturnTo:   tc.returnTo,
+				APIPaths:           []string{"/api/"},
+				BypassHeader:       "X-Maintenance-Bypass",
+				BypassHeaderValue:  "true",
+				Enabled:            true,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			resp := recorder.Result()
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if resp.Header.Get("X-Maintenance-Mode") != "true" {
+				t.Errorf("Expected X-Maintenance-Mode header to be set")
+			}
+
+			if tc.expectedLocation != "" && resp.Header.Get("Location") != tc.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tc.expectedLocation, resp.Header.Get("Location"))
+			}
+
+			if tc.expectJSON {
+				if resp.Header.Get("Location") != "" {
+					t.Errorf("Expected no Location header for API clients, got %q", resp.Header.Get("Location"))
+				}
+
+				body, _ := ioutil.ReadAll(resp.Body)
+				var payload map[string]interface{}
+				if err := json.Unmarshal(body, &payload); err != nil {
+					t.Fatalf("Expected JSON body, got %q: %v", string(body), err)
+				}
+
+				if payload["maintenance"] != true || payload["statusPage"] != "https://status.example.com/incident?src=warden" {
+					t.Errorf("Unexpected JSON body: %v", payload)
+				}
+			}
+		})
+	}
+}
+
+// TestMaintenanceRedirectValidation tests validation of the redirect configuration
+func TestMaintenanceRedirectValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name       string
+		target     string
+		statusCode int
+		apiPaths   []string
+	}{
+		{"Relative URL", "/status", 0, nil},
+		{"Invalid URL", "://status", 0, nil},
+		{"Non redirect status", "https://status.example.com", http.StatusOK, nil},
+		{"Invalid API path", "https://status.example.com", 0, []string{"regex:("}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				RedirectURL:        tc.target,
+				RedirectStatusCode: tc.statusCode,
+				APIPaths:           tc.apiPaths,
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
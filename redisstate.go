@@ -0,0 +1,333 @@
+package traefik_maintenance_warden
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisStateConfig reads the maintenance state from a Redis-compatible server. The key holds a
+// MaintenanceState JSON object or a boolean; publishing anything to the channel after changing
+// the key makes every instance re-read it immediately.
+type RedisStateConfig struct {
+	// Address is the "host:port" of the server. The backend is enabled when it is set.
+	Address string `json:"address,omitempty"`
+
+	// Username is the ACL user sent with AUTH. Leave empty for password-only authentication.
+	Username string `json:"username,omitempty"`
+
+	// Password is sent with AUTH when set
+	Password string `json:"password,omitempty"`
+
+	// DB is the database holding the key
+	DB int `json:"db,omitempty"`
+
+	// Key holds the maintenance state. Defaults to "traefik-maintenance".
+	Key string `json:"key,omitempty"`
+
+	// Channel announces state changes. Defaults to the key name.
+	Channel string `json:"channel,omitempty"`
+
+	// Timeout bounds connecting and each command, in seconds. Defaults to 5.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// writeRESPCommand writes a command as a RESP array of bulk strings
+func writeRESPCommand(w io.Writer, args ...string) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// readRESPReply reads a RESP reply. Simple strings and bulk strings are returned as string,
+// integers as int64, arrays as []interface{}, nil bulk strings and arrays as nil and error
+// replies as redisError.
+func readRESPReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("invalid RESP line %q", line)
+	}
+	payload := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RESP bulk length %q", payload)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RESP array length %q", payload)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESPReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown RESP type %q", line[0])
+	}
+}
+
+// redisConn is a connection to the state server
+type redisConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// do sends a command and reads its reply, turning error replies into errors
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := writeRESPCommand(c.conn, args...); err != nil {
+		return nil, err
+	}
+
+	reply, err := readRESPReply(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+// redisState keeps the maintenance state in sync with a Redis-compatible server. It subscribes
+// to the channel, re-reads the key on every message and reconnects with backoff when the
+// connection drops, keeping the last known state meanwhile.
+type redisState struct {
+	config       RedisStateConfig
+	timeout      time.Duration
+	pingInterval time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+
+	// synced is set once the key has been read, so the state found at startup isn't notified
+	synced bool
+}
+
+// newRedisState validates the configuration and applies the defaults
+func newRedisState(config RedisStateConfig) (*redisState, error) {
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", config.Address, err)
+	}
+	if config.DB < 0 {
+		return nil, fmt.Errorf("db must not be negative")
+	}
+	if config.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	if config.Key == "" {
+		config.Key = "traefik-maintenance"
+	}
+	if config.Channel == "" {
+		config.Channel = config.Key
+	}
+
+	timeout := time.Duration(config.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &redisState{
+		config:       config,
+		timeout:      timeout,
+		pingInterval: 30 * time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   30 * time.Second,
+	}, nil
+}
+
+// dial connects and authenticates, selecting the database when selectDB is set
+func (s *redisState) dial(selectDB bool) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", s.config.Address, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn), timeout: s.timeout}
+
+	if s.config.Password != "" {
+		args := []string{"AUTH", s.config.Password}
+		if s.config.Username != "" {
+			args = []string{"AUTH", s.config.Username, s.config.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if selectDB && s.config.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(s.config.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error selecting db %d: %w", s.config.DB, err)
+		}
+	}
+
+	return c, nil
+}
+
+// run keeps the middleware's state in sync until the context is cancelled
+func (s *redisState) run(ctx context.Context, m *MaintenanceBypass) {
+	backoff := s.minBackoff
+
+	for {
+		subscribed, err := s.session(ctx, m)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			backoff = s.minBackoff
+		}
+
+		m.log(LogLevelError, "Redis state backend %s unavailable, keeping last known state, reconnecting in %v: %v",
+			s.config.Address, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// session subscribes to the channel and applies the key until the connection fails.
+// It reports whether the subscription was established.
+func (s *redisState) session(ctx context.Context, m *MaintenanceBypass) (bool, error) {
+	sub, err := s.dial(false)
+	if err != nil {
+		return false, err
+	}
+	defer sub.conn.Close()
+
+	cmd, err := s.dial(true)
+	if err != nil {
+		return false, err
+	}
+	defer cmd.conn.Close()
+
+	// Close the connections when the context is cancelled to unblock reads
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.conn.Close()
+			cmd.conn.Close()
+		case <-done:
+		}
+	}()
+
+	// Subscribe before reading the key so no change is missed in between
+	if _, err := sub.do("SUBSCRIBE", s.config.Channel); err != nil {
+		return false, fmt.Errorf("error subscribing to %s: %w", s.config.Channel, err)
+	}
+	if err := s.apply(cmd, m); err != nil {
+		return true, err
+	}
+
+	// Keep the subscription alive so half-open connections are detected
+	go func() {
+		ticker := time.NewTicker(s.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sub.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+				if writeRESPCommand(sub.conn, "PING") != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		sub.conn.SetReadDeadline(time.Now().Add(2*s.pingInterval + s.timeout))
+		reply, err := readRESPReply(sub.reader)
+		if err != nil {
+			return true, err
+		}
+
+		message, ok := reply.([]interface{})
+		if !ok || len(message) == 0 || message[0] != "message" {
+			continue
+		}
+
+		if err := s.apply(cmd, m); err != nil {
+			return true, err
+		}
+	}
+}
+
+// apply reads the key and applies its state. A missing key leaves the state unchanged.
+func (s *redisState) apply(cmd *redisConn, m *MaintenanceBypass) error {
+	reply, err := cmd.do("GET", s.config.Key)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", s.config.Key, err)
+	}
+
+	baseline := !s.synced
+	s.synced = true
+
+	value, ok := reply.(string)
+	if !ok {
+		m.log(LogLevelDebug, "Redis state key %s is not set, keeping current state", s.config.Key)
+		return nil
+	}
+
+	state, err := parseMaintenanceState([]byte(value))
+	if err != nil {
+		m.log(LogLevelError, "Ignoring Redis state key %s: %v", s.config.Key, err)
+		return nil
+	}
+
+	m.applyState(state, "Redis key "+s.config.Key, baseline)
+	return nil
+}
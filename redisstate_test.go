@@ -0,0 +1,359 @@
+package traefik_maintenance_warden
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRESPServer is a tiny in-process server implementing the commands used by the state backend
+type testRESPServer struct {
+	listener    net.Listener
+	password    string
+	mutex       sync.Mutex
+	values      map[string]string
+	subscribers map[string][]net.Conn
+	conns       []net.Conn
+}
+
+func newTestRESPServer(t *testing.T, password string) *testRESPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := &testRESPServer{
+		listener:    listener,
+		password:    password,
+		values:      map[string]string{},
+		subscribers: map[string][]net.Conn{},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *testRESPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *testRESPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := s.password == ""
+
+	for {
+		reply, err := readRESPReply(reader)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		if len(items) == 0 {
+			return
+		}
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+
+		s.mutex.Lock()
+		switch command := strings.ToUpper(args[0]); {
+		case command == "AUTH":
+			authenticated = args[len(args)-1] == s.password
+			if authenticated {
+				conn.Write([]byte("+OK\r\n"))
+			} else {
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+			}
+		case !authenticated:
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+		case command == "SELECT":
+			conn.Write([]byte("+OK\r\n"))
+		case command == "GET":
+			if value, ok := s.values[args[1]]; ok {
+				conn.Write([]byte("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"))
+			} else {
+				conn.Write([]byte("$-1\r\n"))
+			}
+		case command == "SUBSCRIBE":
+			s.subscribers[args[1]] = append(s.subscribers[args[1]], conn)
+			writeRESPCommand(conn, "subscribe", args[1])
+		case command == "PING":
+			conn.Write([]byte("*2\r\n$4\r\npong\r\n$0\r\n\r\n"))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// set stores a value and publishes a change notification
+func (s *testRESPServer) set(key, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.values[key] = value
+	for _, conn := range s.subscribers[key] {
+		writeRESPCommand(conn, "message", key, "changed")
+	}
+}
+
+// dropConnections closes every client connection, simulating a network failure
+func (s *testRESPServer) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	s.subscribers = map[string][]net.Conn{}
+}
+
+func (s *testRESPServer) Close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+// waitForStatus polls the middleware until it answers with the expected status
+func waitForStatus(t *testing.T, handler http.Handler, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if recorder.Code == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected status code %d, got %d", expected, recorder.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRedisState tests following the key, instant updates and reconnecting after a failure
+func TestRedisState(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	server := newTestRESPServer(t, "s3cret")
+	defer server.Close()
+	server.set("maintenance", `{"enabled":false}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		RedisState: RedisStateConfig{
+			Address:  server.listener.Addr().String(),
+			Password: "s3cret",
+			DB:       2,
+			Key:      "maintenance",
+		},
+		Enabled: true,
+	}
+
+	middleware, err := New(ctx, nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	// The key overrides the configured state once connected
+	waitForStatus(t, middleware, http.StatusOK)
+
+	// Changes are picked up through the channel
+	server.set("maintenance", "on")
+	waitForStatus(t, middleware, http.StatusServiceUnavailable)
+
+	// The last known state is kept while disconnected, and the key is re-read after reconnecting
+	server.dropConnections()
+	waitForStatus(t, middleware, http.StatusServiceUnavailable)
+	server.mutex.Lock()
+	server.values["maintenance"] = "false"
+	server.mutex.Unlock()
+	waitForStatus(t, middleware, http.StatusOK)
+
+	// Invalid values are ignored
+	server.set("maintenance", "maybe")
+	server.set("maintenance", "1")
+	waitForStatus(t, middleware, http.StatusServiceUnavailable)
+}
+
+// TestRedisStateWebhooks tests that the startup state isn't notified and that changes written
+// to the key are notified once, by the instance sending notifications
+func TestRedisStateWebhooks(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	server := newTestRESPServer(t, "")
+	defer server.Close()
+	server.set("maintenance", "false")
+
+	receiver := &testWebhookReceiver{}
+	webhookServer := httptest.NewServer(receiver)
+	defer webhookServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Every router of the group follows the same key, one of them sends the notifications
+	var middlewares []http.Handler
+	for _, name := range []string{"shop-a", "shop-b", "shop-c"} {
+		cfg := &Config{
+			MaintenanceContent: "<html><body>Maintenance</body></html>",
+			RedisState:         RedisStateConfig{Address: server.listener.Addr().String(), Key: "maintenance"},
+			Webhooks:           []WebhookConfig{{URL: webhookServer.URL, Body: "{{.Middleware}} {{.Event}}"}},
+			NotifyWebhooks:     name == "shop-b",
+			Enabled:            true,
+		}
+
+		middleware, err := New(ctx, nextHandler, cfg, name)
+		if err != nil {
+			t.Fatalf("Error creating middleware: %v", err)
+		}
+		middlewares = append(middlewares, middleware)
+	}
+
+	// The state found at startup differs from the configured one but isn't a change
+	for _, middleware := range middlewares {
+		waitForStatus(t, middleware, http.StatusOK)
+	}
+
+	// Values written straight to the key are notified like any other change
+	server.set("maintenance", "true")
+	for _, middleware := range middlewares {
+		waitForStatus(t, middleware, http.StatusServiceUnavailable)
+	}
+	receiver.waitForDeliveries(t, 1)
+
+	server.set("maintenance", `{"enabled":false,"updatedBy":"deploy-script"}`)
+	for _, middleware := range middlewares {
+		waitForStatus(t, middleware, http.StatusOK)
+	}
+	receiver.waitForDeliveries(t, 2)
+	time.Sleep(50 * time.Millisecond)
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	expectedBodies := []string{"shop-b maintenance.started", "shop-b maintenance.ended"}
+	if len(receiver.bodies) != len(expectedBodies) || receiver.bodies[0] != expectedBodies[0] || receiver.bodies[1] != expectedBodies[1] {
+		t.Errorf("Expected notifications %q, got %q", expectedBodies, receiver.bodies)
+	}
+}
+
+// TestRedisStateBackoff tests that failed connections are retried with growing delays
+func TestRedisStateBackoff(t *testing.T) {
+	server := newTestRESPServer(t, "s3cret")
+	defer server.Close()
+	server.set("traefik-maintenance", "false")
+
+	backend, err := newRedisState(RedisStateConfig{Address: server.listener.Addr().String(), Password: "wrong"})
+	if err != nil {
+		t.Fatalf("Error creating backend: %v", err)
+	}
+	backend.minBackoff = 10 * time.Millisecond
+	backend.maxBackoff = 40 * time.Millisecond
+
+	logBuffer := &testLogWriter{}
+	m := &MaintenanceBypass{enabled: true, logLevel: LogLevelError}
+	m.logger = log.New(logBuffer, "", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		backend.run(ctx, m)
+		close(done)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	logs := logBuffer.String()
+	if !strings.Contains(logs, "reconnecting in 10ms") || !strings.Contains(logs, "reconnecting in 40ms") {
+		t.Errorf("Expected growing reconnect delays, got %q", logs)
+	}
+	if strings.Contains(logs, "reconnecting in 80ms") {
+		t.Errorf("Expected delay to be capped, got %q", logs)
+	}
+	if !m.isEnabled() {
+		t.Errorf("Expected configured state to be kept while the server is unavailable")
+	}
+}
+
+// TestParseMaintenanceState tests the accepted state values
+func TestParseMaintenanceState(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected bool
+		valid    bool
+	}{
+		{`{"enabled":true}`, true, true},
+		{`{"enabled":false,"updatedBy":"ops"}`, false, true},
+		{"true", true, true},
+		{" 0\n", false, true},
+		{"ON", true, true},
+		{"off", false, true},
+		{"maybe", false, false},
+		{`{"enabled":`, false, false},
+	}
+
+	for _, tc := range testCases {
+		state, err := parseMaintenanceState([]byte(tc.value))
+		if (err == nil) != tc.valid {
+			t.Errorf("Value %q: expected valid %v, got error %v", tc.value, tc.valid, err)
+			continue
+		}
+		if tc.valid && state.Enabled != tc.expected {
+			t.Errorf("Value %q: expected enabled %v, got %v", tc.value, tc.expected, state.Enabled)
+		}
+	}
+}
+
+// TestRedisStateValidation tests that misconfigured backends are rejected
+func TestRedisStateValidation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config RedisStateConfig
+	}{
+		{"Address without port", RedisStateConfig{Address: "localhost"}},
+		{"Negative db", RedisStateConfig{Address: "localhost:6379", DB: -1}},
+		{"Negative timeout", RedisStateConfig{Address: "localhost:6379", Timeout: -1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				RedisState:         tc.config,
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package traefik_maintenance_warden
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// defaultRequestIDHeader carries the request ID when no other header is configured
+const defaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied request IDs so they can't flood the logs
+const maxRequestIDLength = 128
+
+// newRequestID returns a random version 4 UUID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// isValidRequestID reports whether a client supplied request ID is safe to log and echo
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureRequestID makes sure the request carries a request ID, generating one when it is missing
+// or unusable. The ID stays on the request so the next handler and the maintenance service get it.
+func (m *MaintenanceBypass) ensureRequestID(req *http.Request) {
+	if m.requestIDHeader == "" || isValidRequestID(req.Header.Get(m.requestIDHeader)) {
+		return
+	}
+	req.Header.Set(m.requestIDHeader, newRequestID())
+}
+
+// setResponseRequestID echoes the request ID on a maintenance response, so it shows up in
+// browser tools and screenshots can be matched with the logs
+func (m *MaintenanceBypass) setResponseRequestID(rw http.ResponseWriter, req *http.Request) {
+	if id := req.Header.Get(m.requestIDHeader); m.requestIDHeader != "" && id != "" {
+		rw.Header().Set(m.requestIDHeader, id)
+	}
+}
+
+// logRequest logs a message about a request, prefixed with its request ID
+func (m *MaintenanceBypass) logRequest(req *http.Request, level LogLevel, format string, v ...interface{}) {
+	if m.requestIDHeader != "" {
+		if id := req.Header.Get(m.requestIDHeader); id != "" {
+			m.log(level, "request_id=%s "+format, append([]interface{}{id}, v...)...)
+			return
+		}
+	}
+	m.log(level, format, v...)
+}
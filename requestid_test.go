@@ -0,0 +1,121 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// TestRequestID tests generating, echoing and logging request IDs
+func TestRequestID(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name       string
+		header     string
+		incoming   string
+		expectedID string
+	}{
+		{"Missing ID is generated", "", "", ""},
+		{"Existing ID is kept", "", "req-1234", "req-1234"},
+		{"Unprintable ID is replaced", "", "bad id", ""},
+		{"Overlong ID is replaced", "", strings.Repeat("a", 200), ""},
+		{"Custom header", "X-Correlation-ID", "corr-42", "corr-42"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				RequestIDHeader:    tc.header,
+				LogLevel:           int(LogLevelInfo),
+				Enabled:            true,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			logBuffer := &testLogWriter{}
+			middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+
+			header := tc.header
+			if header == "" {
+				header = "X-Request-ID"
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tc.incoming != "" {
+				req.Header.Set(header, tc.incoming)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			id := recorder.Header().Get(header)
+			if tc.expectedID != "" && id != tc.expectedID {
+				t.Errorf("Expected request ID %q, got %q", tc.expectedID, id)
+			}
+			if tc.expectedID == "" && !uuidPattern.MatchString(id) {
+				t.Errorf("Expected a generated UUID, got %q", id)
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(logBuffer.String()), "\n") {
+				if !strings.HasPrefix(line, "request_id="+id+" ") {
+					t.Errorf("Expected log line to start with the request ID, got %q", line)
+				}
+			}
+		})
+	}
+}
+
+// TestRequestIDForwarded tests that the request ID reaches the maintenance service and the next handler
+func TestRequestIDForwarded(t *testing.T) {
+	var serviceID, nextID string
+	maintenanceServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		serviceID = req.Header.Get("X-Request-ID")
+		rw.Write([]byte("Maintenance"))
+	}))
+	defer maintenanceServer.Close()
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextID = req.Header.Get("X-Request-ID")
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceService: maintenanceServer.URL,
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if serviceID == "" || serviceID != recorder.Header().Get("X-Request-ID") {
+		t.Errorf("Expected maintenance service to get the response's request ID %q, got %q", recorder.Header().Get("X-Request-ID"), serviceID)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-Maintenance-Bypass", "true")
+	middleware.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !uuidPattern.MatchString(nextID) {
+		t.Errorf("Expected bypassed request to carry a generated request ID, got %q", nextID)
+	}
+}
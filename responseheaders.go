@@ -0,0 +1,149 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryAfter is the Retry-After suggested to clients when no end time is configured
+const defaultRetryAfter = 3600
+
+// isHeaderName reports whether name is a valid HTTP header field name
+func isHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("\"(),/:;<=>?@[\\]{}", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMaintenanceEndTime parses the RFC3339 time maintenance is expected to end, if set
+func parseMaintenanceEndTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	endTime, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid maintenance end time %q: %w", value, err)
+	}
+	return endTime, nil
+}
+
+// retryAfterSeconds returns the Retry-After suggested to clients: the time left until the
+// configured end time, or an hour when there is none
+func (m *MaintenanceBypass) retryAfterSeconds(now time.Time) int {
+	if m.maintenanceEndTime.IsZero() {
+		return defaultRetryAfter
+	}
+
+	seconds := int(m.maintenanceEndTime.Sub(now).Seconds())
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// responseHeaderPlaceholders returns a function expanding placeholders in response header values.
+// On top of the request placeholders, {request_id}, {trace_id}, {end_time} and {retry_after} are supported.
+func (m *MaintenanceBypass) responseHeaderPlaceholders(req *http.Request) func(string) string {
+	expandRequest := headerPlaceholders(req)
+
+	endTime := ""
+	if !m.maintenanceEndTime.IsZero() {
+		endTime = m.maintenanceEndTime.UTC().Format(http.TimeFormat)
+	}
+
+	requestID := ""
+	if m.requestIDHeader != "" {
+		requestID = req.Header.Get(m.requestIDHeader)
+	}
+
+	replacer := strings.NewReplacer(
+		"{request_id}", requestID,
+		"{trace_id}", traceIDFromRequest(req),
+		"{end_time}", endTime,
+		"{retry_after}", strconv.Itoa(m.retryAfterSeconds(time.Now())),
+	)
+
+	return func(value string) string {
+		if !strings.Contains(value, "{") {
+			return value
+		}
+		return replacer.Replace(expandRequest(value))
+	}
+}
+
+// withResponseHeaders wraps the writer of a maintenance response so the configured response
+// headers are applied last, after the content source has set its own headers
+func (m *MaintenanceBypass) withResponseHeaders(rw http.ResponseWriter, req *http.Request) http.ResponseWriter {
+	if len(m.responseHeaders) == 0 {
+		return rw
+	}
+	if _, ok := rw.(*responseHeaderWriter); ok {
+		return rw
+	}
+	return &responseHeaderWriter{ResponseWriter: rw, headers: m.responseHeaders, expand: m.responseHeaderPlaceholders(req)}
+}
+
+// responseHeaderWriter applies the configured response headers right before the status is written.
+// An empty value, or a value expanding to nothing, removes the header.
+type responseHeaderWriter struct {
+	http.ResponseWriter
+	headers map[string]string
+	expand  func(string) string
+	applied bool
+}
+
+// apply sets and removes the configured headers once
+func (w *responseHeaderWriter) apply() {
+	if w.applied {
+		return
+	}
+	w.applied = true
+
+	header := w.ResponseWriter.Header()
+	for name, value := range w.headers {
+		if value = w.expand(value); value == "" {
+			header.Del(name)
+		} else {
+			header.Set(name, value)
+		}
+	}
+}
+
+// WriteHeader applies the headers before writing the status.
+// Informational responses are passed through unchanged.
+func (w *responseHeaderWriter) WriteHeader(statusCode int) {
+	if statusCode >= 200 {
+		w.apply()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write applies the headers before the implicit 200 status is written
+func (w *responseHeaderWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client
+func (w *responseHeaderWriter) Flush() {
+	w.apply()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original response writer so upgraded connections can be hijacked
+func (w *responseHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
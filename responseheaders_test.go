@@ -0,0 +1,153 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestResponseHeaders tests that the configured headers apply to every content source
+func TestResponseHeaders(t *testing.T) {
+	maintenanceServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=600")
+		rw.Header().Set("X-Powered-By", "maintenance-service")
+		rw.Write([]byte("Maintenance"))
+	}))
+	defer maintenanceServer.Close()
+
+	responseHeaders := map[string]string{
+		"X-Robots-Tag":            "noindex",
+		"Content-Security-Policy": "default-src 'self'",
+		"Cache-Control":           "no-store",
+		"X-Maintenance-Mode":      "",
+		"X-Powered-By":            "",
+	}
+
+	testCases := []struct {
+		name   string
+		config *Config
+		path   string
+	}{
+		{"Content", &Config{MaintenanceContent: "<html><body>Maintenance</body></html>"}, "/"},
+		{"Service", &Config{MaintenanceService: maintenanceServer.URL}, "/"},
+		{"Redirect", &Config{RedirectURL: "https://status.example.com"}, "/"},
+		{
+			"Section",
+			&Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				MaintenancePaths:   []MaintenancePath{{Path: "/shop", Content: "Shop closed"}},
+			},
+			"/shop/cart",
+		},
+		{
+			"Rule content",
+			&Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Rules:              []Rule{{Name: "api", Match: RuleMatcher{Path: "/api/*"}, Action: RuleActionContent, Content: "{}"}},
+			},
+			"/api/orders",
+		},
+		{
+			"Minimal User-Agent response",
+			&Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				UserAgentPolicies:  []UserAgentPolicy{{Contains: []string{"Pingdom"}, Action: UserAgentActionMinimal}},
+			},
+			"/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Enabled = true
+			tc.config.ResponseHeaders = responseHeaders
+
+			middleware, err := New(context.Background(), http.NotFoundHandler(), tc.config, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+tc.path, nil)
+			req.Header.Set("User-Agent", "Pingdom.com_bot")
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Header().Get("X-Robots-Tag") != "noindex" || recorder.Header().Get("Content-Security-Policy") != "default-src 'self'" {
+				t.Errorf("Expected configured headers, got %v", recorder.Header())
+			}
+			if recorder.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Expected Cache-Control to be overridden, got %q", recorder.Header().Get("Cache-Control"))
+			}
+			if _, ok := recorder.Header()["X-Maintenance-Mode"]; ok {
+				t.Errorf("Expected X-Maintenance-Mode to be removed, got %q", recorder.Header().Get("X-Maintenance-Mode"))
+			}
+			if _, ok := recorder.Header()["X-Powered-By"]; ok {
+				t.Errorf("Expected X-Powered-By to be removed, got %q", recorder.Header().Get("X-Powered-By"))
+			}
+		})
+	}
+}
+
+// TestResponseHeaderPlaceholders tests templated header values and the end time
+func TestResponseHeaderPlaceholders(t *testing.T) {
+	endTime := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		MaintenanceEndTime: endTime.Format(time.RFC3339),
+		ResponseHeaders: map[string]string{
+			"Expires":       "{end_time}",
+			"X-Maintenance": "id={request_id} host={host}",
+		},
+		Enabled: true,
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if expected := endTime.Format(http.TimeFormat); recorder.Header().Get("Expires") != expected {
+		t.Errorf("Expected Expires %q, got %q", expected, recorder.Header().Get("Expires"))
+	}
+	if expected := "id=req-42 host=example.com"; recorder.Header().Get("X-Maintenance") != expected {
+		t.Errorf("Expected X-Maintenance %q, got %q", expected, recorder.Header().Get("X-Maintenance"))
+	}
+
+	retryAfter, _ := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	if retryAfter < 7100 || retryAfter > 7200 {
+		t.Errorf("Expected Retry-After to count down to the end time, got %q", recorder.Header().Get("Retry-After"))
+	}
+}
+
+// TestResponseHeadersValidation tests that invalid header names and end times are rejected
+func TestResponseHeadersValidation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config *Config
+	}{
+		{"Empty header name", &Config{ResponseHeaders: map[string]string{"": "value"}}},
+		{"Header name with space", &Config{ResponseHeaders: map[string]string{"X Robots": "noindex"}}},
+		{"Header name with colon", &Config{ResponseHeaders: map[string]string{"X-Robots-Tag:": "noindex"}}},
+		{"Invalid end time", &Config{MaintenanceEndTime: "tomorrow"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.MaintenanceContent = "<html><body>Maintenance</body></html>"
+			tc.config.Enabled = true
+
+			if _, err := New(context.Background(), http.NotFoundHandler(), tc.config, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
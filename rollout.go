@@ -0,0 +1,88 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trafficKeySource identifies where the sticky rollout key is read from
+type trafficKeySource int
+
+const (
+	trafficKeyIP trafficKeySource = iota
+	trafficKeyHeader
+	trafficKeyCookie
+)
+
+// trafficKey describes how a client is identified for percentage-based rollout
+type trafficKey struct {
+	source trafficKeySource
+	name   string
+}
+
+// parseTrafficKey parses a traffic key specification of the form "ip", "header:<name>" or "cookie:<name>"
+func parseTrafficKey(spec string) (trafficKey, error) {
+	if spec == "" || spec == "ip" {
+		return trafficKey{source: trafficKeyIP}, nil
+	}
+
+	kind, name, found := strings.Cut(spec, ":")
+	if !found || name == "" {
+		return trafficKey{}, fmt.Errorf("invalid traffic key %q, expected ip, header:<name> or cookie:<name>", spec)
+	}
+
+	switch kind {
+	case "header":
+		return trafficKey{source: trafficKeyHeader, name: name}, nil
+	case "cookie":
+		return trafficKey{source: trafficKeyCookie, name: name}, nil
+	default:
+		return trafficKey{}, fmt.Errorf("invalid traffic key source %q, expected ip, header or cookie", kind)
+	}
+}
+
+// value extracts the key value from the request, falling back to the client IP when missing
+func (k trafficKey) value(req *http.Request) string {
+	switch k.source {
+	case trafficKeyHeader:
+		if value := req.Header.Get(k.name); value != "" {
+			return value
+		}
+	case trafficKeyCookie:
+		if cookie, err := req.Cookie(k.name); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	return clientIP(req)
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// trafficBucket maps a key to a stable bucket in the range [0, 100)
+func trafficBucket(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % 100)
+}
+
+// inMaintenanceRollout reports whether the request falls within the configured traffic percentage.
+// Buckets only depend on the client key, so a client keeps the same outcome across requests and
+// routers, and raising the percentage only ever adds clients to maintenance.
+func (m *MaintenanceBypass) inMaintenanceRollout(req *http.Request) bool {
+	if m.trafficPercentage >= 100 {
+		return true
+	}
+
+	return trafficBucket(m.trafficKey.value(req)) < m.trafficPercentage
+}
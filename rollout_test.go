@@ -0,0 +1,156 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseTrafficKey tests parsing of traffic key specifications
+func TestParseTrafficKey(t *testing.T) {
+	testCases := []struct {
+		spec           string
+		expectedSource trafficKeySource
+		expectedName   string
+		shouldHaveErr  bool
+	}{
+		{"", trafficKeyIP, "", false},
+		{"ip", trafficKeyIP, "", false},
+		{"header:X-User-ID", trafficKeyHeader, "X-User-ID", false},
+		{"cookie:session", trafficKeyCookie, "session", false},
+		{"cookie:", 0, "", true},
+		{"query:user", 0, "", true},
+		{"header", 0, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			key, err := parseTrafficKey(tc.spec)
+
+			if tc.shouldHaveErr {
+				if err == nil {
+					t.Errorf("Expected error for traffic key %q, got none", tc.spec)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error for traffic key %q: %v", tc.spec, err)
+			}
+
+			if key.source != tc.expectedSource || key.name != tc.expectedName {
+				t.Errorf("Expected source %d and name %q, got %d and %q", tc.expectedSource, tc.expectedName, key.source, key.name)
+			}
+		})
+	}
+}
+
+// TestTrafficPercentage tests that only a sticky share of clients gets the maintenance page
+func TestTrafficPercentage(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name       string
+		percentage int
+		minBlocked int
+		maxBlocked int
+	}{
+		{"Zero percentage blocks everyone", 0, 1000, 1000},
+		{"Full percentage blocks everyone", 100, 1000, 1000},
+		{"Half percentage blocks roughly half", 50, 400, 600},
+		{"Ten percentage blocks roughly a tenth", 10, 50, 150},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				BypassHeader:       "X-Maintenance-Bypass",
+				BypassHeaderValue:  "true",
+				Enabled:            true,
+				TrafficPercentage:  tc.percentage,
+				TrafficKey:         "cookie:session",
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			blocked := 0
+			for i := 0; i < 1000; i++ {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+				req.AddCookie(&http.Cookie{Name: "session", Value: fmt.Sprintf("user-%d", i)})
+
+				recorder := httptest.NewRecorder()
+				middleware.ServeHTTP(recorder, req)
+
+				status := recorder.Result().StatusCode
+				if status == http.StatusServiceUnavailable {
+					blocked++
+				}
+
+				// The same client must get the same outcome on a second request
+				recorder = httptest.NewRecorder()
+				middleware.ServeHTTP(recorder, req)
+				if recorder.Result().StatusCode != status {
+					t.Fatalf("Client user-%d flipped between %d and %d", i, status, recorder.Result().StatusCode)
+				}
+			}
+
+			if blocked < tc.minBlocked || blocked > tc.maxBlocked {
+				t.Errorf("Expected between %d and %d blocked clients, got %d", tc.minBlocked, tc.maxBlocked, blocked)
+			}
+		})
+	}
+}
+
+// TestTrafficPercentageFallsBackToIP tests that clients without the configured key are identified by IP
+func TestTrafficPercentageFallsBackToIP(t *testing.T) {
+	key := trafficKey{source: trafficKeyHeader, name: "X-User-ID"}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+
+	if value := key.value(req); value != "192.0.2.10" {
+		t.Errorf("Expected fallback to client IP 192.0.2.10, got %q", value)
+	}
+
+	req.Header.Set("X-User-ID", "user-42")
+	if value := key.value(req); value != "user-42" {
+		t.Errorf("Expected header value user-42, got %q", value)
+	}
+}
+
+// TestTrafficPercentageValidation tests that out of range percentages are rejected
+func TestTrafficPercentageValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	for _, percentage := range []int{-1, 101} {
+		cfg := &Config{
+			MaintenanceContent: "<html><body>Maintenance</body></html>",
+			Enabled:            true,
+			TrafficPercentage:  percentage,
+		}
+
+		if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+			t.Errorf("Expected error for traffic percentage %d, got none", percentage)
+		}
+	}
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+		TrafficKey:         "query:user",
+	}
+
+	if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+		t.Errorf("Expected error for invalid traffic key, got none")
+	}
+}
@@ -0,0 +1,604 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule actions decide what happens to a request matched by a rule
+const (
+	// RuleActionBypass passes the request through to the next handler
+	RuleActionBypass = "bypass"
+	// RuleActionBlock serves the maintenance response, skipping every other bypass check
+	RuleActionBlock = "block"
+	// RuleActionRedirect redirects the request to the rule's redirect URL
+	RuleActionRedirect = "redirect"
+	// RuleActionContent serves the rule's own content variant
+	RuleActionContent = "content"
+)
+
+// Rule is a declarative bypass or maintenance decision evaluated before the built-in checks
+type Rule struct {
+	// Name identifies the rule in logs
+	Name string `json:"name,omitempty"`
+
+	// Match selects the requests the rule applies to. An empty matcher matches every request.
+	Match RuleMatcher `json:"match,omitempty"`
+
+	// Action is one of "bypass", "block", "redirect" or "content"
+	Action string `json:"action,omitempty"`
+
+	// RedirectURL is the target of the "redirect" action
+	RedirectURL string `json:"redirectURL,omitempty"`
+
+	// StatusCode is the status of the "redirect" (default 302) and "content" (default StatusCode) actions
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Content is the body served by the "content" action
+	Content string `json:"content,omitempty"`
+
+	// ContentType is the content type of the "content" action. Defaults to ContentType.
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// RuleMatcher combines request matchers. All fields that are set must match (AND).
+// All, Any and Not nest further matchers with AND, OR and NOT semantics.
+type RuleMatcher struct {
+	// Path matches the request path: a prefix, "exact:<path>" or "regex:<expression>"
+	Path string `json:"path,omitempty"`
+
+	// Methods matches any of the listed HTTP methods
+	Methods []string `json:"methods,omitempty"`
+
+	// Host matches the request host, either exactly or as "*.example.com"
+	Host string `json:"host,omitempty"`
+
+	// Headers matches header values. A value of "*" only requires the header to be present.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Query matches query parameter values. A value of "*" only requires the parameter to be present.
+	Query map[string]string `json:"query,omitempty"`
+
+	// Cookies matches cookie values. A value of "*" only requires the cookie to be present.
+	Cookies map[string]string `json:"cookies,omitempty"`
+
+	// IPs matches the client IP against a list of addresses or CIDR ranges
+	IPs []string `json:"ips,omitempty"`
+
+	// Time matches requests received within a time window
+	Time *TimeMatcher `json:"time,omitempty"`
+
+	// All matches when every nested matcher matches
+	All []RuleMatcher `json:"all,omitempty"`
+
+	// Any matches when at least one nested matcher matches
+	Any []RuleMatcher `json:"any,omitempty"`
+
+	// Not matches when the nested matcher does not match
+	Not *RuleMatcher `json:"not,omitempty"`
+}
+
+// TimeMatcher matches requests by the time they are received
+type TimeMatcher struct {
+	// Start is the RFC3339 time from which the matcher applies
+	Start string `json:"start,omitempty"`
+
+	// End is the RFC3339 time until which the matcher applies
+	End string `json:"end,omitempty"`
+
+	// DailyFrom is the "15:04" time of day from which the matcher applies
+	DailyFrom string `json:"dailyFrom,omitempty"`
+
+	// DailyUntil is the "15:04" time of day until which the matcher applies. May wrap past midnight.
+	DailyUntil string `json:"dailyUntil,omitempty"`
+
+	// Weekdays restricts the matcher to the listed days, e.g. "Mon" or "Saturday"
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Timezone is the IANA time zone used for the daily window and weekdays. Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// matcher is a compiled request matcher
+type matcher interface {
+	match(req *http.Request, now time.Time) bool
+}
+
+// compiledRule is a rule ready to be evaluated
+type compiledRule struct {
+	name        string
+	matcher     matcher
+	action      string
+	redirectURL string
+	statusCode  int
+	content     []byte
+	contentType string
+}
+
+// compileRules compiles the configured rules, applying the middleware defaults. Problems are
+// recorded on v with the index of the rule, so every broken rule is reported at once.
+func compileRules(v *configValidator, rules []Rule, statusCode int, contentType string) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for i, rule := range rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+
+		m, err := compileMatcher(rule.Match)
+		v.check(field+".match", err)
+
+		cr := compiledRule{
+			name:        name,
+			matcher:     m,
+			action:      rule.Action,
+			redirectURL: rule.RedirectURL,
+			statusCode:  rule.StatusCode,
+			content:     []byte(rule.Content),
+			contentType: rule.ContentType,
+		}
+
+		switch rule.Action {
+		case RuleActionBypass, RuleActionBlock:
+		case RuleActionRedirect:
+			if rule.RedirectURL == "" {
+				v.fail(field+".redirectURL", "redirect action requires a redirectURL")
+			}
+			if cr.statusCode == 0 {
+				cr.statusCode = http.StatusFound
+			}
+			if cr.statusCode < 300 || cr.statusCode > 399 {
+				v.fail(field+".statusCode", "redirect status code must be 3xx, got %d", cr.statusCode)
+			}
+		case RuleActionContent:
+			if rule.Content == "" {
+				v.fail(field+".content", "content action requires content")
+			}
+			v.statusCode(field+".statusCode", rule.StatusCode)
+			if cr.statusCode == 0 {
+				cr.statusCode = statusCode
+			}
+			if cr.contentType == "" {
+				cr.contentType = contentType
+			}
+		default:
+			v.fail(field+".action", "invalid action %q", rule.Action)
+		}
+
+		compiled = append(compiled, cr)
+	}
+
+	return compiled
+}
+
+// compileMatcher compiles a matcher tree. Every configured criterion must match.
+func compileMatcher(config RuleMatcher) (matcher, error) {
+	var matchers allMatcher
+
+	if config.Path != "" {
+		pm, err := compilePathPattern(config.Path)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, pm)
+	}
+
+	if len(config.Methods) > 0 {
+		matchers = append(matchers, methodMatcher(config.Methods))
+	}
+
+	if config.Host != "" {
+		matchers = append(matchers, hostMatcher(strings.ToLower(config.Host)))
+	}
+
+	for name, value := range config.Headers {
+		matchers = append(matchers, valueMatcher{name: name, value: value, lookup: lookupHeader})
+	}
+
+	for name, value := range config.Query {
+		matchers = append(matchers, valueMatcher{name: name, value: value, lookup: lookupQuery})
+	}
+
+	for name, value := range config.Cookies {
+		matchers = append(matchers, valueMatcher{name: name, value: value, lookup: lookupCookie})
+	}
+
+	if len(config.IPs) > 0 {
+		im, err := compileIPMatcher(config.IPs)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, im)
+	}
+
+	if config.Time != nil {
+		tm, err := compileTimeMatcher(*config.Time)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, tm)
+	}
+
+	if len(config.All) > 0 {
+		var all allMatcher
+		for _, nested := range config.All {
+			nm, err := compileMatcher(nested)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, nm)
+		}
+		matchers = append(matchers, all)
+	}
+
+	if len(config.Any) > 0 {
+		var anyOf anyMatcher
+		for _, nested := range config.Any {
+			nm, err := compileMatcher(nested)
+			if err != nil {
+				return nil, err
+			}
+			anyOf = append(anyOf, nm)
+		}
+		matchers = append(matchers, anyOf)
+	}
+
+	if config.Not != nil {
+		nm, err := compileMatcher(*config.Not)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, notMatcher{matcher: nm})
+	}
+
+	return matchers, nil
+}
+
+// allMatcher matches when every matcher matches. An empty list matches everything.
+type allMatcher []matcher
+
+func (a allMatcher) match(req *http.Request, now time.Time) bool {
+	for _, m := range a {
+		if !m.match(req, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyMatcher matches when at least one matcher matches
+type anyMatcher []matcher
+
+func (a anyMatcher) match(req *http.Request, now time.Time) bool {
+	for _, m := range a {
+		if m.match(req, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// notMatcher inverts a matcher
+type notMatcher struct {
+	matcher matcher
+}
+
+func (n notMatcher) match(req *http.Request, now time.Time) bool {
+	return !n.matcher.match(req, now)
+}
+
+// pathMatcher matches the request path by prefix, exact value or regular expression
+type pathMatcher struct {
+	prefix string
+	exact  string
+	regex  *regexp.Regexp
+}
+
+// compilePathPattern compiles a path pattern: a prefix, "exact:<path>" or "regex:<expression>"
+func compilePathPattern(pattern string) (pathMatcher, error) {
+	switch {
+	case strings.HasPrefix(pattern, "regex:"):
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "regex:"))
+		if err != nil {
+			return pathMatcher{}, fmt.Errorf("invalid path regex %q: %w", pattern, err)
+		}
+		return pathMatcher{regex: re}, nil
+	case strings.HasPrefix(pattern, "exact:"):
+		return pathMatcher{exact: strings.TrimPrefix(pattern, "exact:")}, nil
+	default:
+		return pathMatcher{prefix: pattern}, nil
+	}
+}
+
+func (p pathMatcher) match(req *http.Request, now time.Time) bool {
+	return p.matchPath(req.URL.Path)
+}
+
+// matchPath reports whether the path matches the pattern
+func (p pathMatcher) matchPath(path string) bool {
+	switch {
+	case p.regex != nil:
+		return p.regex.MatchString(path)
+	case p.exact != "":
+		return path == p.exact
+	default:
+		return strings.HasPrefix(path, p.prefix)
+	}
+}
+
+// methodMatcher matches any of the listed methods
+type methodMatcher []string
+
+func (mm methodMatcher) match(req *http.Request, now time.Time) bool {
+	for _, method := range mm {
+		if strings.EqualFold(req.Method, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatcher matches the request host exactly or, with a "*." prefix, any subdomain
+type hostMatcher string
+
+func (h hostMatcher) match(req *http.Request, now time.Time) bool {
+	host := strings.ToLower(req.Host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	pattern := string(h)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// valueMatcher matches a named request value such as a header, query parameter or cookie
+type valueMatcher struct {
+	name   string
+	value  string
+	lookup func(req *http.Request, name string) (string, bool)
+}
+
+func (v valueMatcher) match(req *http.Request, now time.Time) bool {
+	value, ok := v.lookup(req, v.name)
+	if !ok {
+		return false
+	}
+	return v.value == "*" || value == v.value
+}
+
+// lookupHeader returns a header value
+func lookupHeader(req *http.Request, name string) (string, bool) {
+	values := req.Header.Values(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// lookupQuery returns a query parameter value
+func lookupQuery(req *http.Request, name string) (string, bool) {
+	values, ok := req.URL.Query()[name]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// lookupCookie returns a cookie value
+func lookupCookie(req *http.Request, name string) (string, bool) {
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// ipMatcher matches the client IP against a list of networks
+type ipMatcher []*net.IPNet
+
+// compileIPMatcher parses a list of addresses and CIDR ranges
+func compileIPMatcher(ips []string) (ipMatcher, error) {
+	var networks ipMatcher
+
+	for _, value := range ips {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func (im ipMatcher) match(req *http.Request, now time.Time) bool {
+	return im.contains(clientIP(req))
+}
+
+// contains reports whether the address belongs to one of the networks
+func (im ipMatcher) contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range im {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeMatcher matches requests within an absolute and/or daily window
+type timeMatcher struct {
+	start      time.Time
+	end        time.Time
+	dailyFrom  int
+	dailyUntil int
+	daily      bool
+	weekdays   map[time.Weekday]bool
+	location   *time.Location
+}
+
+// compileTimeMatcher parses a time window
+func compileTimeMatcher(config TimeMatcher) (*timeMatcher, error) {
+	tm := &timeMatcher{location: time.UTC}
+
+	if config.Timezone != "" {
+		location, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", config.Timezone, err)
+		}
+		tm.location = location
+	}
+
+	var err error
+	if config.Start != "" {
+		if tm.start, err = time.Parse(time.RFC3339, config.Start); err != nil {
+			return nil, fmt.Errorf("invalid start time %q: %w", config.Start, err)
+		}
+	}
+	if config.End != "" {
+		if tm.end, err = time.Parse(time.RFC3339, config.End); err != nil {
+			return nil, fmt.Errorf("invalid end time %q: %w", config.End, err)
+		}
+	}
+
+	if config.DailyFrom != "" || config.DailyUntil != "" {
+		if tm.dailyFrom, err = parseTimeOfDay(config.DailyFrom, 0); err != nil {
+			return nil, err
+		}
+		if tm.dailyUntil, err = parseTimeOfDay(config.DailyUntil, 24*60); err != nil {
+			return nil, err
+		}
+		tm.daily = true
+	}
+
+	if len(config.Weekdays) > 0 {
+		tm.weekdays = make(map[time.Weekday]bool)
+		for _, name := range config.Weekdays {
+			day, err := parseWeekday(name)
+			if err != nil {
+				return nil, err
+			}
+			tm.weekdays[day] = true
+		}
+	}
+
+	return tm, nil
+}
+
+// parseTimeOfDay parses "15:04" into minutes since midnight
+func parseTimeOfDay(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// parseWeekday parses a full or abbreviated English weekday name
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := day.String()
+		if strings.EqualFold(name, full) || strings.EqualFold(name, full[:3]) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", name)
+}
+
+func (tm *timeMatcher) match(req *http.Request, now time.Time) bool {
+	if !tm.start.IsZero() && now.Before(tm.start) {
+		return false
+	}
+	if !tm.end.IsZero() && !now.Before(tm.end) {
+		return false
+	}
+
+	local := now.In(tm.location)
+	if tm.weekdays != nil && !tm.weekdays[local.Weekday()] {
+		return false
+	}
+
+	if tm.daily {
+		minute := local.Hour()*60 + local.Minute()
+		if tm.dailyFrom <= tm.dailyUntil {
+			return minute >= tm.dailyFrom && minute < tm.dailyUntil
+		}
+		// The window wraps past midnight
+		return minute >= tm.dailyFrom || minute < tm.dailyUntil
+	}
+
+	return true
+}
+
+// matchRule returns the first rule matching the request, or nil
+func (m *MaintenanceBypass) matchRule(req *http.Request) *compiledRule {
+	now := time.Now()
+	for i := range m.rules {
+		if m.rules[i].matcher.match(req, now) {
+			return &m.rules[i]
+		}
+	}
+	return nil
+}
+
+// applyRule performs the action of a matched rule
+func (m *MaintenanceBypass) applyRule(rw http.ResponseWriter, req *http.Request, rule *compiledRule) {
+	m.logRequest(req, LogLevelDebug, "Rule %q matched %s, action %s", rule.name, req.URL.String(), rule.action)
+
+	switch rule.action {
+	case RuleActionBypass:
+		m.next.ServeHTTP(rw, req)
+	case RuleActionRedirect, RuleActionContent:
+		req, span := m.startMaintenanceSpan(req)
+		defer m.endMaintenanceSpan(req, span, "rule")
+		rw = m.withResponseHeaders(rw, req)
+		m.setResponseRequestID(rw, req)
+		if m.handlePreflight(rw, req) || m.rateLimited(rw, req) {
+			return
+		}
+		m.applyCORSHeaders(rw, req)
+		rw.Header().Set("X-Maintenance-Mode", "true")
+
+		if rule.action == RuleActionRedirect {
+			http.Redirect(rw, req, rule.redirectURL, rule.statusCode)
+			return
+		}
+
+		rw.Header().Set("Retry-After", strconv.Itoa(m.retryAfterSeconds(time.Now())))
+		rw.Header().Set("Content-Type", rule.contentType)
+		rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		writeMaintenanceBody(rw, req, rule.statusCode, renderMaintenanceBody(req, rule.content))
+	default:
+		m.serveMaintenance(rw, req)
+	}
+}
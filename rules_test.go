@@ -0,0 +1,237 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRuleMatchers tests the individual matchers and their combinations
+func TestRuleMatchers(t *testing.T) {
+	now := time.Date(2026, 3, 14, 22, 30, 0, 0, time.UTC) // A Saturday
+
+	testCases := []struct {
+		name     string
+		matcher  RuleMatcher
+		setup    func(req *http.Request)
+		expected bool
+	}{
+		{"Empty matcher matches everything", RuleMatcher{}, nil, true},
+		{"Path prefix", RuleMatcher{Path: "/api"}, nil, true},
+		{"Path exact mismatch", RuleMatcher{Path: "exact:/api"}, nil, false},
+		{"Path regex", RuleMatcher{Path: `regex:^/api/v[0-9]+/`}, nil, true},
+		{"Method", RuleMatcher{Methods: []string{"POST", "get"}}, nil, true},
+		{"Method mismatch", RuleMatcher{Methods: []string{"POST"}}, nil, false},
+		{"Host exact", RuleMatcher{Host: "Shop.Example.com"}, nil, true},
+		{"Host wildcard", RuleMatcher{Host: "*.example.com"}, nil, true},
+		{"Host mismatch", RuleMatcher{Host: "admin.example.com"}, nil, false},
+		{"Header value", RuleMatcher{Headers: map[string]string{"X-Team": "ops"}}, func(req *http.Request) { req.Header.Set("X-Team", "ops") }, true},
+		{"Header presence", RuleMatcher{Headers: map[string]string{"X-Team": "*"}}, func(req *http.Request) { req.Header.Set("X-Team", "dev") }, true},
+		{"Header missing", RuleMatcher{Headers: map[string]string{"X-Team": "*"}}, nil, false},
+		{"Query value", RuleMatcher{Query: map[string]string{"preview": "1"}}, nil, true},
+		{"Cookie value", RuleMatcher{Cookies: map[string]string{"beta": "yes"}}, func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "beta", Value: "yes"}) }, true},
+		{"IP in CIDR", RuleMatcher{IPs: []string{"10.0.0.0/8"}}, nil, true},
+		{"IP single address mismatch", RuleMatcher{IPs: []string{"10.0.0.2"}}, nil, false},
+		{"Time within daily window wrapping midnight", RuleMatcher{Time: &TimeMatcher{DailyFrom: "22:00", DailyUntil: "06:00"}}, nil, true},
+		{"Time outside daily window", RuleMatcher{Time: &TimeMatcher{DailyFrom: "08:00", DailyUntil: "18:00"}}, nil, false},
+		{"Time weekday", RuleMatcher{Time: &TimeMatcher{Weekdays: []string{"Sat", "Sunday"}}}, nil, true},
+		{"Time absolute window ended", RuleMatcher{Time: &TimeMatcher{End: "2026-03-01T00:00:00Z"}}, nil, false},
+		{"Fields are combined with AND", RuleMatcher{Path: "/api", Methods: []string{"POST"}}, nil, false},
+		{"All", RuleMatcher{All: []RuleMatcher{{Path: "/api"}, {Host: "*.example.com"}}}, nil, true},
+		{"Any", RuleMatcher{Any: []RuleMatcher{{Path: "/admin"}, {Methods: []string{"GET"}}}}, nil, true},
+		{"Not", RuleMatcher{Not: &RuleMatcher{Path: "/api"}}, nil, false},
+		{"Nested combination", RuleMatcher{Any: []RuleMatcher{{Not: &RuleMatcher{IPs: []string{"10.0.0.0/8"}}}, {Path: "/api", Not: &RuleMatcher{Methods: []string{"DELETE"}}}}}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := compileMatcher(tc.matcher)
+			if err != nil {
+				t.Fatalf("Error compiling matcher: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://shop.example.com/api/v2/items?preview=1", nil)
+			req.RemoteAddr = "10.0.0.1:4321"
+			if tc.setup != nil {
+				tc.setup(req)
+			}
+
+			if result := m.match(req, now); result != tc.expected {
+				t.Errorf("Expected match to be %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+// TestRuleCompilationErrors tests that invalid rules are rejected when the middleware is created
+func TestRuleCompilationErrors(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name string
+		rule Rule
+	}{
+		{"Unknown action", Rule{Action: "allow"}},
+		{"Redirect without URL", Rule{Action: RuleActionRedirect}},
+		{"Redirect with non 3xx status", Rule{Action: RuleActionRedirect, RedirectURL: "https://status.example.com", StatusCode: 200}},
+		{"Content without content", Rule{Action: RuleActionContent}},
+		{"Invalid path regex", Rule{Action: RuleActionBypass, Match: RuleMatcher{Path: "regex:("}}},
+		{"Invalid IP", Rule{Action: RuleActionBypass, Match: RuleMatcher{IPs: []string{"not-an-ip"}}}},
+		{"Invalid nested time", Rule{Action: RuleActionBypass, Match: RuleMatcher{Not: &RuleMatcher{Time: &TimeMatcher{DailyFrom: "25:00"}}}}},
+		{"Invalid weekday", Rule{Action: RuleActionBypass, Match: RuleMatcher{Time: &TimeMatcher{Weekdays: []string{"Funday"}}}}},
+		{"Invalid timezone", Rule{Action: RuleActionBypass, Match: RuleMatcher{Time: &TimeMatcher{Timezone: "Mars/Olympus"}}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Enabled:            true,
+				Rules:              []Rule{tc.rule},
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
+
+// TestRuleActions tests that rules are evaluated first-match-wins before the built-in checks
+func TestRuleActions(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte("backend"))
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		BypassPaths:        []string{"/api"},
+		Enabled:            true,
+		LogLevel:           int(LogLevelDebug),
+		Rules: []Rule{
+			{Name: "block-api-writes", Match: RuleMatcher{Path: "/api", Methods: []string{"POST"}}, Action: RuleActionBlock},
+			{Name: "office", Match: RuleMatcher{IPs: []string{"192.0.2.0/24"}}, Action: RuleActionBypass},
+			{Name: "status", Match: RuleMatcher{Path: "/status"}, Action: RuleActionRedirect, RedirectURL: "https://status.example.com"},
+			{Name: "api-json", Match: RuleMatcher{Path: "/v2"}, Action: RuleActionContent, Content: `{"maintenance":true}`, ContentType: "application/json", StatusCode: 502},
+			{Name: "shadowed", Match: RuleMatcher{Path: "/v2"}, Action: RuleActionBypass},
+		},
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+
+	testCases := []struct {
+		name             string
+		method           string
+		path             string
+		remoteAddr       string
+		bypassHeader     bool
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+		expectedRule     string
+	}{
+		{"Block rule wins over bypass path", http.MethodPost, "/api/orders", "198.51.100.1:1234", false, http.StatusServiceUnavailable, "Maintenance", "", "block-api-writes"},
+		{"Block rule wins over bypass header", http.MethodPost, "/api/orders", "198.51.100.1:1234", true, http.StatusServiceUnavailable, "Maintenance", "", "block-api-writes"},
+		{"Bypass rule by IP", http.MethodGet, "/", "192.0.2.15:1234", false, http.StatusOK, "backend", "", "office"},
+		{"Redirect rule", http.MethodGet, "/status", "198.51.100.1:1234", false, http.StatusFound, "", "https://status.example.com", "status"},
+		{"Content rule", http.MethodGet, "/v2/items", "198.51.100.1:1234", false, 502, `{"maintenance":true}`, "", "api-json"},
+		{"Built-in bypass path when no rule matches", http.MethodGet, "/api/orders", "198.51.100.1:1234", false, http.StatusOK, "backend", "", ""},
+		{"Maintenance page when nothing matches", http.MethodGet, "/", "198.51.100.1:1234", false, http.StatusServiceUnavailable, "Maintenance", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logBuffer.Reset()
+
+			req := httptest.NewRequest(tc.method, "http://example.com"+tc.path, nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.bypassHeader {
+				req.Header.Set("X-Maintenance-Bypass", "true")
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			resp := recorder.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if !strings.Contains(string(body), tc.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tc.expectedBody, string(body))
+			}
+
+			if tc.expectedLocation != "" && resp.Header.Get("Location") != tc.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tc.expectedLocation, resp.Header.Get("Location"))
+			}
+
+			if tc.expectedRule != "" && !strings.Contains(logBuffer.String(), `Rule "`+tc.expectedRule+`" matched`) {
+				t.Errorf("Expected debug log naming rule %q, got %q", tc.expectedRule, logBuffer.String())
+			}
+
+			if tc.expectedRule == "" && strings.Contains(logBuffer.String(), "Rule ") {
+				t.Errorf("Expected no rule to match, got %q", logBuffer.String())
+			}
+		})
+	}
+}
+
+// TestRuleResponsesAreTraced tests that redirect and content rules get a request ID and a span
+func TestRuleResponsesAreTraced(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Enabled:            true,
+		LogLevel:           int(LogLevelInfo),
+		Rules: []Rule{
+			{Name: "status", Match: RuleMatcher{Path: "/status"}, Action: RuleActionRedirect, RedirectURL: "https://status.example.com"},
+			{Name: "api-json", Match: RuleMatcher{Path: "/v2"}, Action: RuleActionContent, Content: `{"maintenance":true}`},
+		},
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+
+	for _, path := range []string{"/status", "/v2/items"} {
+		t.Run(path, func(t *testing.T) {
+			logBuffer.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+			req.Header.Set("traceparent", testTraceparent)
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			id := recorder.Header().Get("X-Request-ID")
+			if !uuidPattern.MatchString(id) {
+				t.Errorf("Expected a generated request ID, got %q", id)
+			}
+
+			logs := logBuffer.String()
+			if !strings.Contains(logs, "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") || !strings.Contains(logs, "decision=rule") {
+				t.Errorf("Expected a span log for the rule, got %q", logs)
+			}
+		})
+	}
+}
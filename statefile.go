@@ -0,0 +1,315 @@
+package traefik_maintenance_warden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStateRefreshInterval is how often the shared state file is checked for changes
+const defaultStateRefreshInterval = time.Second
+
+// MaintenanceState is the maintenance state shared by the instances of a group
+type MaintenanceState struct {
+	// Enabled reports whether maintenance mode is on
+	Enabled bool `json:"enabled"`
+
+	// UpdatedAt is when the state last changed
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// UpdatedBy identifies the instance that changed the state
+	UpdatedBy string `json:"updatedBy,omitempty"`
+}
+
+// parseMaintenanceState parses a state value from an external store: either a MaintenanceState
+// JSON object or a plain boolean such as "true", "1" or "on"
+func parseMaintenanceState(value []byte) (MaintenanceState, error) {
+	trimmed := strings.TrimSpace(string(value))
+
+	if strings.HasPrefix(trimmed, "{") {
+		var state MaintenanceState
+		if err := json.Unmarshal([]byte(trimmed), &state); err != nil {
+			return MaintenanceState{}, fmt.Errorf("invalid maintenance state: %w", err)
+		}
+		return state, nil
+	}
+
+	switch strings.ToLower(trimmed) {
+	case "on":
+		return MaintenanceState{Enabled: true}, nil
+	case "off":
+		return MaintenanceState{Enabled: false}, nil
+	}
+
+	enabled, err := strconv.ParseBool(trimmed)
+	if err != nil {
+		return MaintenanceState{}, fmt.Errorf("invalid maintenance state %q", trimmed)
+	}
+	return MaintenanceState{Enabled: enabled}, nil
+}
+
+// stateFileContent is the layout of the shared state file, holding one state per group
+type stateFileContent struct {
+	Groups map[string]MaintenanceState `json:"groups"`
+}
+
+// stateFile reads and writes the state of a maintenance group in a JSON file shared by every
+// instance of the group. Writes hold a lock file and replace the file with an atomic rename,
+// so readers never see a partial file and concurrent writers don't lose each other's groups.
+type stateFile struct {
+	path            string
+	group           string
+	refreshInterval time.Duration
+	lockTimeout     time.Duration
+	staleLockAge    time.Duration
+
+	mutex     sync.Mutex
+	lastCheck time.Time
+	lastMod   time.Time
+	lastSize  int64
+	lastError string
+}
+
+// newStateFile creates the state file of a maintenance group
+func newStateFile(path, group string) *stateFile {
+	return &stateFile{
+		path:            path,
+		group:           group,
+		refreshInterval: defaultStateRefreshInterval,
+		lockTimeout:     5 * time.Second,
+		staleLockAge:    30 * time.Second,
+	}
+}
+
+// poll returns the group's state when the file changed since the last poll. The file is checked
+// at most once per refresh interval. A missing file or group means no state has been written yet.
+func (s *stateFile) poll(now time.Time) (MaintenanceState, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.lastCheck) < s.refreshInterval {
+		return MaintenanceState{}, false, nil
+	}
+	s.lastCheck = now
+
+	state, ok, err := s.check()
+	if err == nil {
+		s.lastError = ""
+	}
+	return state, ok, err
+}
+
+// check reads the group's state when the file changed since it was last read
+func (s *stateFile) check() (MaintenanceState, bool, error) {
+	fileInfo, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return MaintenanceState{}, false, nil
+	}
+	if err != nil {
+		return MaintenanceState{}, false, fmt.Errorf("error accessing state file: %w", err)
+	}
+
+	if fileInfo.ModTime().Equal(s.lastMod) && fileInfo.Size() == s.lastSize {
+		return MaintenanceState{}, false, nil
+	}
+
+	content, err := s.read()
+	if err != nil {
+		return MaintenanceState{}, false, err
+	}
+	s.lastMod = fileInfo.ModTime()
+	s.lastSize = fileInfo.Size()
+
+	state, ok := content.Groups[s.group]
+	return state, ok, nil
+}
+
+// recordError remembers a failed poll, reporting whether err differs from the previous failure.
+// A successful poll forgets the failure.
+func (s *stateFile) recordError(err error) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := err.Error() != s.lastError
+	s.lastError = err.Error()
+	return changed
+}
+
+// read parses the state file. A missing file is an empty state.
+func (s *stateFile) read() (stateFileContent, error) {
+	content := stateFileContent{Groups: map[string]MaintenanceState{}}
+
+	data, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return content, nil
+	}
+	if err != nil {
+		return content, fmt.Errorf("error reading state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &content); err != nil {
+		return content, fmt.Errorf("error parsing state file: %w", err)
+	}
+	if content.Groups == nil {
+		content.Groups = map[string]MaintenanceState{}
+	}
+
+	return content, nil
+}
+
+// write stores the group's state, keeping the state of every other group in the file
+func (s *stateFile) write(state MaintenanceState) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content, err := s.read()
+	if err != nil {
+		return err
+	}
+	content.Groups[s.group] = state
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state file: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temporary state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing temporary state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error replacing state file: %w", err)
+	}
+
+	return nil
+}
+
+// lock acquires the lock file next to the state file, returning the function releasing it.
+// A lock older than the stale lock age is left over from a crashed writer and is taken over.
+func (s *stateFile) lock() (func(), error) {
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(s.lockTimeout)
+
+	for {
+		lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			lockFile.WriteString(strconv.Itoa(os.Getpid()))
+			lockFile.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("error creating state lock file: %w", err)
+		}
+
+		if lockInfo, statErr := os.Stat(lockPath); statErr == nil && time.Since(lockInfo.ModTime()) > s.staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for state lock file %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// isEnabled reports whether maintenance mode is on, picking up changes to the shared state first
+func (m *MaintenanceBypass) isEnabled() bool {
+	m.refreshState()
+
+	m.stateMutex.RLock()
+	defer m.stateMutex.RUnlock()
+	return m.enabled
+}
+
+// setEnabled switches maintenance mode on this instance, logging the change and its source.
+// Webhooks are only notified of the change when notify is set.
+func (m *MaintenanceBypass) setEnabled(enabled bool, source string, notify bool) {
+	m.stateMutex.Lock()
+	changed := m.enabled != enabled
+	m.enabled = enabled
+	if changed {
+		m.updateDrainStart(enabled, time.Now())
+	}
+	m.stateMutex.Unlock()
+
+	if changed {
+		m.log(LogLevelInfo, "Maintenance mode %s by %s", enabledLabel(enabled), source)
+		if notify {
+			m.notifyStateChange(enabled, source)
+		}
+	}
+}
+
+// applyState applies a state read from a shared store. The first state read from a store is the
+// baseline the instance starts from, not a change, and is never notified.
+func (m *MaintenanceBypass) applyState(state MaintenanceState, source string, baseline bool) {
+	m.setEnabled(state.Enabled, source, !baseline)
+}
+
+// refreshState applies changes to the group's shared state file. When the file can't be read
+// the current state is kept, and a failure that persists is logged once rather than on every poll.
+func (m *MaintenanceBypass) refreshState() {
+	if m.stateFile == nil {
+		return
+	}
+
+	state, ok, err := m.stateFile.poll(time.Now())
+	if err != nil {
+		if m.stateFile.recordError(err) {
+			m.log(LogLevelError, "Failed to read state of maintenance group %q, keeping current state: %v", m.stateFile.group, err)
+		}
+		return
+	}
+	if ok {
+		m.applyState(state, fmt.Sprintf("maintenance group %q", m.stateFile.group), false)
+	}
+}
+
+// SetEnabled switches maintenance mode on or off. When the instance belongs to a maintenance group
+// the state is written to the group's state file, so every router in the group follows.
+// Traefik never calls it: it is meant for programs embedding the middleware, while operators
+// toggle a group by writing its state file.
+func (m *MaintenanceBypass) SetEnabled(enabled bool) error {
+	if m.stateFile != nil {
+		state := MaintenanceState{Enabled: enabled, UpdatedAt: time.Now().UTC(), UpdatedBy: m.name}
+		if err := m.stateFile.write(state); err != nil {
+			return fmt.Errorf("error updating maintenance group %q: %w", m.stateFile.group, err)
+		}
+	}
+
+	m.setEnabled(enabled, m.name, true)
+	return nil
+}
+
+// enabledLabel describes a maintenance state in logs
+func enabledLabel(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
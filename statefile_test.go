@@ -0,0 +1,232 @@
+package traefik_maintenance_warden
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMaintenanceGroup tests that a toggle on one instance applies to every instance of the group
+func TestMaintenanceGroup(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	stateFilePath := filepath.Join(tmpDir, "state.json")
+
+	newInstance := func(name, group string) *MaintenanceBypass {
+		cfg := &Config{
+			MaintenanceContent: "<html><body>Maintenance</body></html>",
+			MaintenanceGroup:   group,
+			StateFile:          stateFilePath,
+			Enabled:            true,
+		}
+
+		middleware, err := New(context.Background(), nextHandler, cfg, name)
+		if err != nil {
+			t.Fatalf("Error creating middleware: %v", err)
+		}
+
+		m := middleware.(*MaintenanceBypass)
+		m.stateFile.refreshInterval = 0
+		return m
+	}
+
+	status := func(m *MaintenanceBypass) int {
+		recorder := httptest.NewRecorder()
+		m.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		return recorder.Code
+	}
+
+	shop := newInstance("shop-router", "shop")
+	checkout := newInstance("checkout-router", "shop")
+	blog := newInstance("blog-router", "blog")
+
+	// Without a written state every instance follows its configuration
+	if status(shop) != http.StatusServiceUnavailable || status(checkout) != http.StatusServiceUnavailable {
+		t.Fatalf("Expected configured state before the group state is written")
+	}
+
+	if err := shop.SetEnabled(false); err != nil {
+		t.Fatalf("Error disabling maintenance: %v", err)
+	}
+
+	if code := status(checkout); code != http.StatusOK {
+		t.Errorf("Expected other instance of the group to follow, got status %d", code)
+	}
+	if code := status(blog); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected other groups to be unaffected, got status %d", code)
+	}
+
+	// Instances created later start from the shared state
+	if code := status(newInstance("cart-router", "shop")); code != http.StatusOK {
+		t.Errorf("Expected new instance to start from the group state, got status %d", code)
+	}
+
+	if err := blog.SetEnabled(false); err != nil {
+		t.Fatalf("Error disabling maintenance: %v", err)
+	}
+	if err := checkout.SetEnabled(true); err != nil {
+		t.Fatalf("Error enabling maintenance: %v", err)
+	}
+
+	if code := status(shop); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected instance to follow the group again, got status %d", code)
+	}
+
+	content, err := shop.stateFile.read()
+	if err != nil {
+		t.Fatalf("Error reading state file: %v", err)
+	}
+	if !content.Groups["shop"].Enabled || content.Groups["blog"].Enabled || content.Groups["shop"].UpdatedBy != "checkout-router" {
+		t.Errorf("Expected both groups to be kept in the state file, got %+v", content.Groups)
+	}
+
+	// A corrupt file keeps the current state
+	if err := ioutil.WriteFile(stateFilePath, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	logBuffer := &bytes.Buffer{}
+	shop.logger = log.New(logBuffer, "", 0)
+	shop.logLevel = LogLevelError
+
+	for i := 0; i < 3; i++ {
+		if code := status(shop); code != http.StatusServiceUnavailable {
+			t.Errorf("Expected current state to be kept when the file is corrupt, got status %d", code)
+		}
+	}
+	if count := strings.Count(logBuffer.String(), "Failed to read state of maintenance group"); count != 1 {
+		t.Errorf("Expected a corrupt state file to be logged once, got %d times: %s", count, logBuffer.String())
+	}
+
+	// Once the file is readable again a new failure is logged again
+	if err := ioutil.WriteFile(stateFilePath, []byte(`{"groups":{"shop":{"enabled":true}}}`), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	status(shop)
+	if err := ioutil.WriteFile(stateFilePath, []byte("{still not json"), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	status(shop)
+	if count := strings.Count(logBuffer.String(), "Failed to read state of maintenance group"); count != 2 {
+		t.Errorf("Expected a new failure after recovery to be logged, got %d times: %s", count, logBuffer.String())
+	}
+}
+
+// TestStateFileConcurrentWrites tests that concurrent writers don't lose each other's groups
+func TestStateFileConcurrentWrites(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	stateFilePath := filepath.Join(tmpDir, "state.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- newStateFile(stateFilePath, fmt.Sprintf("group-%d", i)).write(MaintenanceState{Enabled: true})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Error writing state file: %v", err)
+		}
+	}
+
+	content, err := newStateFile(stateFilePath, "group-0").read()
+	if err != nil {
+		t.Fatalf("Error reading state file: %v", err)
+	}
+	if len(content.Groups) != 20 {
+		t.Errorf("Expected 20 groups, got %d", len(content.Groups))
+	}
+
+	if _, err := os.Stat(stateFilePath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("Expected lock file to be released")
+	}
+}
+
+// TestStateFileLock tests waiting for a held lock and taking over a stale one
+func TestStateFileLock(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	state := newStateFile(filepath.Join(tmpDir, "state.json"), "shop")
+	state.lockTimeout = 50 * time.Millisecond
+
+	lockPath := state.path + ".lock"
+	if err := ioutil.WriteFile(lockPath, []byte("1"), 0644); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	if err := state.write(MaintenanceState{Enabled: true}); err == nil {
+		t.Errorf("Expected write to time out while the lock is held")
+	}
+
+	stale := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatalf("Failed to age lock file: %v", err)
+	}
+
+	if err := state.write(MaintenanceState{Enabled: true}); err != nil {
+		t.Errorf("Expected stale lock to be taken over, got %v", err)
+	}
+}
+
+// TestMaintenanceGroupValidation tests that a group requires a state file and vice versa
+func TestMaintenanceGroupValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name      string
+		group     string
+		stateFile string
+	}{
+		{"Group without state file", "shop", ""},
+		{"State file without group", "", "/tmp/state.json"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				MaintenanceGroup:   tc.group,
+				StateFile:          tc.stateFile,
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream policies control how WebSocket upgrades and Server-Sent Events requests are handled
+// during maintenance
+const (
+	// StreamPolicyReject answers with the reject status code and a Retry-After header
+	StreamPolicyReject = "reject"
+	// StreamPolicyAllow passes the request through to the next handler
+	StreamPolicyAllow = "allow"
+	// StreamPolicyMaintenance serves the regular maintenance response, proxying upgrades to the maintenance service
+	StreamPolicyMaintenance = "maintenance"
+	// StreamPolicyEvent sends a single maintenance event and closes the stream (Server-Sent Events only)
+	StreamPolicyEvent = "event"
+)
+
+// validateStreamPolicy checks a stream policy and applies the default
+func validateStreamPolicy(policy string, allowEvent bool) (string, error) {
+	switch policy {
+	case "":
+		return StreamPolicyReject, nil
+	case StreamPolicyReject, StreamPolicyAllow, StreamPolicyMaintenance:
+		return policy, nil
+	case StreamPolicyEvent:
+		if allowEvent {
+			return policy, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid stream policy %q", policy)
+}
+
+// isUpgradeRequest reports whether the request asks for a protocol upgrade such as WebSocket
+func isUpgradeRequest(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isEventStreamRequest reports whether the request asks for a Server-Sent Events stream
+func isEventStreamRequest(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+}
+
+// handleStreamRequest applies the configured stream policy to upgrade and event stream requests.
+// It returns false when the request should get the regular maintenance response.
+func (m *MaintenanceBypass) handleStreamRequest(rw http.ResponseWriter, req *http.Request) bool {
+	var kind, policy string
+	switch {
+	case isUpgradeRequest(req):
+		kind, policy = "upgrade", m.webSocketPolicy
+	case isEventStreamRequest(req):
+		kind, policy = "event stream", m.ssePolicy
+	default:
+		return false
+	}
+
+	if policy == StreamPolicyAllow {
+		m.logRequest(req, LogLevelDebug, "Allowing %s request %s through during maintenance", kind, req.URL.String())
+		m.next.ServeHTTP(rw, req)
+		return true
+	}
+
+	// Streams answered here are rate limited like any other maintenance response, so clients
+	// reconnecting in a loop are slowed down. The maintenance policy is limited by serveMaintenance.
+	if (policy == StreamPolicyEvent || policy == StreamPolicyReject) && m.rateLimited(rw, req) {
+		return true
+	}
+
+	switch policy {
+	case StreamPolicyEvent:
+		m.logRequest(req, LogLevelInfo, "Sending maintenance event to %s request %s", kind, req.URL.String())
+		m.serveMaintenanceEvent(rw)
+	case StreamPolicyReject:
+		m.logRequest(req, LogLevelInfo, "Rejecting %s request %s during maintenance", kind, req.URL.String())
+		rw.Header().Set("Retry-After", strconv.Itoa(m.retryAfterSeconds(time.Now())))
+		rw.Header().Set("X-Maintenance-Mode", "true")
+		rw.Header().Set("Connection", "close")
+		http.Error(rw, "Service Temporarily Unavailable", m.streamStatusCode)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// serveMaintenanceEvent sends a single maintenance event. The retry field asks EventSource
+// clients to wait until the Retry-After delay before reconnecting instead of retrying in a tight loop.
+func (m *MaintenanceBypass) serveMaintenanceEvent(rw http.ResponseWriter) {
+	retryAfter := m.retryAfterSeconds(time.Now())
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Maintenance-Mode", "true")
+	rw.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(rw, "retry: %d\n", retryAfter*1000)
+	fmt.Fprint(rw, "event: maintenance\n")
+	fmt.Fprintf(rw, "data: {\"maintenance\":true,\"retryAfter\":%d}\n\n", retryAfter)
+
+	if flusher, ok := rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,288 @@
+package traefik_maintenance_warden
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStreamPolicies tests the handling of upgrade and event stream requests during maintenance
+func TestStreamPolicies(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name             string
+		webSocketPolicy  string
+		ssePolicy        string
+		streamStatusCode int
+		headers          map[string]string
+		expectedStatus   int
+		expectedType     string
+		expectedBody     string
+	}{
+		{
+			name:           "Upgrade is rejected by default",
+			headers:        map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket"},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Service Temporarily Unavailable",
+		},
+		{
+			name:             "Upgrade is rejected with custom status",
+			streamStatusCode: http.StatusGone,
+			headers:          map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"},
+			expectedStatus:   http.StatusGone,
+		},
+		{
+			name:            "Upgrade is allowed through",
+			webSocketPolicy: StreamPolicyAllow,
+			headers:         map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"},
+			expectedStatus:  http.StatusOK,
+		},
+		{
+			name:            "Upgrade gets the maintenance page",
+			webSocketPolicy: StreamPolicyMaintenance,
+			headers:         map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"},
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedType:    "text/html; charset=utf-8",
+			expectedBody:    "<html><body>Maintenance</body></html>",
+		},
+		{
+			name:           "Event stream is rejected by default",
+			headers:        map[string]string{"Accept": "text/event-stream"},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Event stream gets a single maintenance event",
+			ssePolicy:      StreamPolicyEvent,
+			headers:        map[string]string{"Accept": "text/event-stream"},
+			expectedStatus: http.StatusOK,
+			expectedType:   "text/event-stream",
+			expectedBody:   "event: maintenance\n",
+		},
+		{
+			name:           "Event stream is allowed through",
+			ssePolicy:      StreamPolicyAllow,
+			headers:        map[string]string{"Accept": "text/event-stream"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Regular request gets the maintenance page",
+			ssePolicy:      StreamPolicyAllow,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "<html><body>Maintenance</body></html>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				BypassHeader:       "X-Maintenance-Bypass",
+				BypassHeaderValue:  "true",
+				Enabled:            true,
+				WebSocketPolicy:    tc.webSocketPolicy,
+				SSEPolicy:          tc.ssePolicy,
+				StreamStatusCode:   tc.streamStatusCode,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/live", nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			resp := recorder.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			if resp.StatusCode != http.StatusOK && resp.Header.Get("Retry-After") == "" {
+				t.Errorf("Expected Retry-After header to be set")
+			}
+
+			if tc.expectedType != "" && resp.Header.Get("Content-Type") != tc.expectedType {
+				t.Errorf("Expected Content-Type %q, got %q", tc.expectedType, resp.Header.Get("Content-Type"))
+			}
+
+			if !strings.Contains(string(body), tc.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tc.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+// TestStreamPolicyValidation tests that unknown stream policies are rejected
+func TestStreamPolicyValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name            string
+		webSocketPolicy string
+		ssePolicy       string
+	}{
+		{"Unknown WebSocket policy", "drop", ""},
+		{"Event policy is not valid for WebSocket", StreamPolicyEvent, ""},
+		{"Unknown SSE policy", "", "drop"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Enabled:            true,
+				WebSocketPolicy:    tc.webSocketPolicy,
+				SSEPolicy:          tc.ssePolicy,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
+
+// TestStreamRateLimit tests that each stream request uses a single rate limit token whatever the policy
+func TestStreamRateLimit(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name            string
+		webSocketPolicy string
+		expectedStatus  int
+	}{
+		{"Rejected upgrades", StreamPolicyReject, http.StatusServiceUnavailable},
+		{"Upgrades getting the maintenance page", StreamPolicyMaintenance, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Enabled:            true,
+				WebSocketPolicy:    tc.webSocketPolicy,
+				RateLimitAverage:   1,
+				RateLimitBurst:     2,
+			}
+
+			middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			for i, expected := range []int{tc.expectedStatus, tc.expectedStatus, http.StatusTooManyRequests} {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/live", nil)
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+
+				recorder := httptest.NewRecorder()
+				middleware.ServeHTTP(recorder, req)
+
+				if recorder.Code != expected {
+					t.Errorf("Expected request %d to get status %d, got %d", i+1, expected, recorder.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestWebSocketUpgradeThroughProxy tests that upgrades are proxied to the maintenance service
+func TestWebSocketUpgradeThroughProxy(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Error("Next handler should not be called")
+	})
+
+	// The maintenance service accepts the upgrade and echoes a single line
+	maintenanceServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !isUpgradeRequest(req) {
+			t.Errorf("Expected upgrade request at maintenance service")
+			return
+		}
+
+		conn, brw, err := http.NewResponseController(rw).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprint(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+
+		line, err := brw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fmt.Fprint(brw, "echo: "+line)
+		brw.Flush()
+	}))
+	defer maintenanceServer.Close()
+
+	cfg := &Config{
+		MaintenanceService: maintenanceServer.URL,
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		Enabled:            true,
+		WebSocketPolicy:    StreamPolicyMaintenance,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	frontServer := httptest.NewServer(middleware)
+	defer frontServer.Close()
+
+	conn, err := net.DialTimeout("tcp", strings.TrimPrefix(frontServer.URL, "http://"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /live HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status code %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+
+	fmt.Fprint(conn, "ping\n")
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		t.Fatalf("Failed to read echoed data: %v", err)
+	}
+
+	if line != "echo: ping\n" {
+		t.Errorf("Expected echoed data %q, got %q", "echo: ping\n", line)
+	}
+}
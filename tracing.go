@@ -0,0 +1,125 @@
+package traefik_maintenance_warden
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// traceIDPlaceholder is replaced with the trace ID in maintenance content
+const traceIDPlaceholder = "{trace_id}"
+
+// traceContext is the W3C trace context of a maintenance decision. The decision is recorded as a
+// span, child of the incoming traceparent when there is one, so traces show where the request ended.
+type traceContext struct {
+	traceID      string
+	spanID       string
+	parentSpanID string
+	flags        string
+	traceState   string
+	start        time.Time
+}
+
+// traceContextKey stores the trace context in the request context
+type traceContextKey struct{}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isHexID reports whether id is a lowercase hex string of the given length that isn't all zeros
+func isHexID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newTraceContext continues the trace of the incoming traceparent header, or starts a new trace
+// when it is missing or invalid. The tracestate is only kept along with a valid traceparent.
+func newTraceContext(req *http.Request) *traceContext {
+	span := &traceContext{spanID: randomHex(8), flags: "01", start: time.Now()}
+
+	parts := strings.Split(strings.TrimSpace(req.Header.Get("traceparent")), "-")
+	if len(parts) >= 4 && len(parts[0]) == 2 && parts[0] != "ff" && isHexID(parts[1], 32) && isHexID(parts[2], 16) && len(parts[3]) == 2 {
+		span.traceID = parts[1]
+		span.parentSpanID = parts[2]
+		span.flags = parts[3]
+		span.traceState = req.Header.Get("tracestate")
+		return span
+	}
+
+	span.traceID = randomHex(16)
+	return span
+}
+
+// traceparent returns the traceparent header identifying the span
+func (t *traceContext) traceparent() string {
+	return "00-" + t.traceID + "-" + t.spanID + "-" + t.flags
+}
+
+// traceFromRequest returns the trace context of a maintenance decision, or nil
+func traceFromRequest(req *http.Request) *traceContext {
+	span, _ := req.Context().Value(traceContextKey{}).(*traceContext)
+	return span
+}
+
+// traceIDFromRequest returns the trace ID of a maintenance decision, or "" outside of one
+func traceIDFromRequest(req *http.Request) string {
+	if span := traceFromRequest(req); span != nil {
+		return span.traceID
+	}
+	return ""
+}
+
+// startMaintenanceSpan starts the span of a maintenance decision and attaches it to the request
+func (m *MaintenanceBypass) startMaintenanceSpan(req *http.Request) (*http.Request, *traceContext) {
+	if span := traceFromRequest(req); span != nil {
+		return req, span
+	}
+
+	span := newTraceContext(req)
+	return req.WithContext(context.WithValue(req.Context(), traceContextKey{}, span)), span
+}
+
+// endMaintenanceSpan logs the span of a maintenance decision
+func (m *MaintenanceBypass) endMaintenanceSpan(req *http.Request, span *traceContext, decision string) {
+	m.logRequest(req, LogLevelInfo, "Maintenance span trace_id=%s span_id=%s parent_span_id=%s decision=%s duration=%v",
+		span.traceID, span.spanID, span.parentSpanID, decision, time.Since(span.start))
+}
+
+// propagateTraceContext makes the maintenance service continue the trace as a child of the decision span
+func propagateTraceContext(proxyReq, req *http.Request) {
+	span := traceFromRequest(req)
+	if span == nil {
+		return
+	}
+
+	proxyReq.Header.Set("traceparent", span.traceparent())
+	if span.traceState != "" {
+		proxyReq.Header.Set("tracestate", span.traceState)
+	} else {
+		proxyReq.Header.Del("tracestate")
+	}
+}
+
+// renderMaintenanceBody fills in the trace ID so support can correlate user reports with traces
+func renderMaintenanceBody(req *http.Request, body []byte) []byte {
+	span := traceFromRequest(req)
+	if span == nil || !bytes.Contains(body, []byte(traceIDPlaceholder)) {
+		return body
+	}
+	return bytes.ReplaceAll(body, []byte(traceIDPlaceholder), []byte(span.traceID))
+}
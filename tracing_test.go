@@ -0,0 +1,154 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// TestNewTraceContext tests continuing incoming traces and starting new ones
+func TestNewTraceContext(t *testing.T) {
+	testCases := []struct {
+		name            string
+		traceparent     string
+		expectedTraceID string
+		expectedParent  string
+		expectedState   string
+	}{
+		{"Valid traceparent", testTraceparent, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", "vendor=value"},
+		{"Future version with extra fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", "vendor=value"},
+		{"Missing traceparent", "", "", "", ""},
+		{"All zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", ""},
+		{"Uppercase hex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", "", "", ""},
+		{"Invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tc.traceparent != "" {
+				req.Header.Set("traceparent", tc.traceparent)
+			}
+			req.Header.Set("tracestate", "vendor=value")
+
+			span := newTraceContext(req)
+
+			if tc.expectedTraceID != "" && span.traceID != tc.expectedTraceID {
+				t.Errorf("Expected trace ID %q, got %q", tc.expectedTraceID, span.traceID)
+			}
+			if !isHexID(span.traceID, 32) || !isHexID(span.spanID, 16) {
+				t.Errorf("Expected valid IDs, got trace %q span %q", span.traceID, span.spanID)
+			}
+			if span.parentSpanID != tc.expectedParent {
+				t.Errorf("Expected parent span %q, got %q", tc.expectedParent, span.parentSpanID)
+			}
+			if span.traceState != tc.expectedState {
+				t.Errorf("Expected tracestate %q, got %q", tc.expectedState, span.traceState)
+			}
+		})
+	}
+}
+
+// TestTraceContextPropagation tests that the maintenance service continues the trace
+func TestTraceContextPropagation(t *testing.T) {
+	var traceparent, tracestate string
+	maintenanceServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		tracestate = req.Header.Get("tracestate")
+		rw.Write([]byte("Maintenance"))
+	}))
+	defer maintenanceServer.Close()
+
+	cfg := &Config{
+		MaintenanceService: maintenanceServer.URL,
+		Enabled:            true,
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	req.Header.Set("tracestate", "vendor=value")
+	middleware.ServeHTTP(httptest.NewRecorder(), req)
+
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[1] != "4bf92f3577b34da6a3ce929d0e0e4736" || parts[3] != "01" {
+		t.Fatalf("Expected the trace to be continued, got traceparent %q", traceparent)
+	}
+	if parts[2] == "00f067aa0ba902b7" {
+		t.Errorf("Expected the maintenance span to be the parent, got the incoming span")
+	}
+	if tracestate != "vendor=value" {
+		t.Errorf("Expected tracestate to be forwarded, got %q", tracestate)
+	}
+}
+
+// TestTraceIDInMaintenanceResponse tests the trace ID in the page, the JSON body and the span log
+func TestTraceIDInMaintenanceResponse(t *testing.T) {
+	testCases := []struct {
+		name             string
+		config           *Config
+		accept           string
+		expectedDecision string
+	}{
+		{
+			"Content placeholder",
+			&Config{MaintenanceContent: "<p>Reference: {trace_id}</p>", LogLevel: int(LogLevelInfo), Enabled: true},
+			"text/html",
+			"decision=content",
+		},
+		{
+			"Redirect JSON body",
+			&Config{RedirectURL: "https://status.example.com", LogLevel: int(LogLevelInfo), Enabled: true},
+			"application/json",
+			"decision=redirect",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			middleware, err := New(context.Background(), http.NotFoundHandler(), tc.config, "maintenance-test")
+			if err != nil {
+				t.Fatalf("Error creating middleware: %v", err)
+			}
+
+			logBuffer := &testLogWriter{}
+			middleware.(*MaintenanceBypass).logger = log.New(logBuffer, "", 0)
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("traceparent", testTraceparent)
+			req.Header.Set("Accept", tc.accept)
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+			if tc.accept == "application/json" {
+				var body map[string]interface{}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Expected JSON body, got %q", recorder.Body.String())
+				}
+				if body["traceId"] != traceID {
+					t.Errorf("Expected traceId %q, got %v", traceID, body["traceId"])
+				}
+			} else if !strings.Contains(recorder.Body.String(), "Reference: "+traceID) {
+				t.Errorf("Expected trace ID in page, got %q", recorder.Body.String())
+			}
+
+			logs := logBuffer.String()
+			if !strings.Contains(logs, "trace_id="+traceID) || !strings.Contains(logs, "parent_span_id=00f067aa0ba902b7") ||
+				!strings.Contains(logs, tc.expectedDecision) || !strings.Contains(logs, "duration=") {
+				t.Errorf("Expected span log with trace ID and %s, got %q", tc.expectedDecision, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User-Agent policy actions decide how matching clients are treated during maintenance
+const (
+	// UserAgentActionBypass passes the request through to the next handler
+	UserAgentActionBypass = "bypass"
+	// UserAgentActionMinimal answers with the policy's status code and a short plain text body
+	UserAgentActionMinimal = "minimal"
+	// UserAgentActionPage serves the normal maintenance response
+	UserAgentActionPage = "page"
+)
+
+// UserAgentPolicy selects clients by User-Agent, e.g. search engine crawlers or uptime monitors
+type UserAgentPolicy struct {
+	// Name identifies the policy in logs
+	Name string `json:"name,omitempty"`
+
+	// Contains matches User-Agents containing any of the listed substrings, ignoring case
+	Contains []string `json:"contains,omitempty"`
+
+	// Regex matches User-Agents matching any of the listed regular expressions
+	Regex []string `json:"regex,omitempty"`
+
+	// Action is one of "bypass", "minimal" or "page"
+	Action string `json:"action,omitempty"`
+
+	// StatusCode is the status of the "minimal" action. Defaults to StatusCode.
+	StatusCode int `json:"statusCode,omitempty"`
+}
+
+// compiledUserAgentPolicy is a User-Agent policy ready to be evaluated
+type compiledUserAgentPolicy struct {
+	name       string
+	contains   []string
+	regexes    []*regexp.Regexp
+	action     string
+	statusCode int
+}
+
+// compileUserAgentPolicies compiles the configured policies, applying the middleware status code.
+// Problems are recorded on v with the index of the policy.
+func compileUserAgentPolicies(v *configValidator, policies []UserAgentPolicy, statusCode int) []compiledUserAgentPolicy {
+	compiled := make([]compiledUserAgentPolicy, 0, len(policies))
+
+	for i, policy := range policies {
+		field := fmt.Sprintf("userAgentPolicies[%d]", i)
+		name := policy.Name
+		if name == "" {
+			name = fmt.Sprintf("user-agent-policy-%d", i)
+		}
+
+		if len(policy.Contains) == 0 && len(policy.Regex) == 0 {
+			v.fail(field, "contains or regex must be set")
+		}
+
+		switch policy.Action {
+		case UserAgentActionBypass, UserAgentActionMinimal, UserAgentActionPage:
+		default:
+			v.fail(field+".action", "invalid action %q", policy.Action)
+		}
+
+		cp := compiledUserAgentPolicy{
+			name:       name,
+			action:     policy.Action,
+			statusCode: policy.StatusCode,
+		}
+		if cp.statusCode == 0 {
+			cp.statusCode = statusCode
+		}
+		if cp.statusCode < 100 || cp.statusCode > 599 {
+			v.fail(field+".statusCode", "invalid status code %d", cp.statusCode)
+		}
+
+		for j, substring := range policy.Contains {
+			if substring == "" {
+				v.fail(fmt.Sprintf("%s.contains[%d]", field, j), "must not be empty")
+				continue
+			}
+			cp.contains = append(cp.contains, strings.ToLower(substring))
+		}
+
+		for j, expression := range policy.Regex {
+			re, err := regexp.Compile(expression)
+			if err != nil {
+				v.fail(fmt.Sprintf("%s.regex[%d]", field, j), "invalid regex %q: %v", expression, err)
+				continue
+			}
+			cp.regexes = append(cp.regexes, re)
+		}
+
+		compiled = append(compiled, cp)
+	}
+
+	return compiled
+}
+
+// matches reports whether the User-Agent matches any of the policy's patterns
+func (p *compiledUserAgentPolicy) matches(userAgent string) bool {
+	lower := strings.ToLower(userAgent)
+	for _, substring := range p.contains {
+		if strings.Contains(lower, substring) {
+			return true
+		}
+	}
+	for _, re := range p.regexes {
+		if re.MatchString(userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUserAgentPolicy returns the first policy matching the request's User-Agent, or nil
+func (m *MaintenanceBypass) matchUserAgentPolicy(req *http.Request) *compiledUserAgentPolicy {
+	userAgent := req.UserAgent()
+	if userAgent == "" {
+		return nil
+	}
+
+	for i := range m.userAgentPolicies {
+		if m.userAgentPolicies[i].matches(userAgent) {
+			return &m.userAgentPolicies[i]
+		}
+	}
+	return nil
+}
+
+// serveMinimalMaintenance answers with a status and a short plain text body, sparing crawlers
+// and monitors the full maintenance page. It returns false when the client was rate limited instead.
+func (m *MaintenanceBypass) serveMinimalMaintenance(rw http.ResponseWriter, req *http.Request, statusCode int) bool {
+	rw = m.withResponseHeaders(rw, req)
+	m.applyCORSHeaders(rw, req)
+	m.setResponseRequestID(rw, req)
+
+	// Monitors polling in a tight loop are limited like any other maintenance response
+	if m.rateLimited(rw, req) {
+		return false
+	}
+
+	rw.Header().Set("Retry-After", strconv.Itoa(m.retryAfterSeconds(time.Now())))
+	rw.Header().Set("X-Maintenance-Mode", "true")
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	writeMaintenanceBody(rw, req, statusCode, []byte(http.StatusText(statusCode)+"\n"))
+	return true
+}
@@ -0,0 +1,149 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestUserAgentPolicies tests the per User-Agent responses
+func TestUserAgentPolicies(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeader:       "X-Maintenance-Bypass",
+		BypassHeaderValue:  "true",
+		UserAgentPolicies: []UserAgentPolicy{
+			{Name: "monitors", Contains: []string{"Pingdom"}, Action: UserAgentActionBypass},
+			{Name: "status-checks", Regex: []string{`^StatusCake/\d+`}, Action: UserAgentActionMinimal, StatusCode: http.StatusOK},
+			{Name: "crawlers", Contains: []string{"googlebot", "bingbot"}, Action: UserAgentActionMinimal},
+			{Name: "internal", Contains: []string{"internal-browser"}, Action: UserAgentActionPage},
+		},
+		Enabled: true,
+	}
+
+	middleware, err := New(context.Background(), nextHandler, cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		userAgent      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Monitor bypasses", "Pingdom.com_bot_version_1.4", http.StatusOK, ""},
+		{"Regex with custom status", "StatusCake/2 (https://www.statuscake.com)", http.StatusOK, "OK"},
+		{"Crawler gets a minimal 503, ignoring case", "Mozilla/5.0 (compatible; Googlebot/2.1)", http.StatusServiceUnavailable, "Service Unavailable"},
+		{"Page action serves the normal page", "internal-browser/1.0", http.StatusServiceUnavailable, "Maintenance"},
+		{"Unmatched User-Agent gets the normal page", "Mozilla/5.0 (X11; Linux x86_64)", http.StatusServiceUnavailable, "Maintenance"},
+		{"Missing User-Agent gets the normal page", "", http.StatusServiceUnavailable, "Maintenance"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("User-Agent", tc.userAgent)
+
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			if recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tc.expectedStatus, recorder.Code)
+			}
+
+			if tc.expectedBody != "" && !strings.Contains(recorder.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	// Minimal responses still announce maintenance so crawlers come back later
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; bingbot/2.0)")
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Header().Get("Retry-After") == "" || recorder.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected a plain text response with Retry-After, got headers %v", recorder.Header())
+	}
+
+	// Bypass conditions still take precedence over the policies
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("User-Agent", "Googlebot/2.1")
+	req.Header.Set("X-Maintenance-Bypass", "true")
+	recorder = httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected bypass header to take precedence, got status %d", recorder.Code)
+	}
+}
+
+// TestUserAgentPoliciesValidation tests that misconfigured policies are rejected
+func TestUserAgentPoliciesValidation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name   string
+		policy UserAgentPolicy
+	}{
+		{"No patterns", UserAgentPolicy{Action: UserAgentActionBypass}},
+		{"Invalid action", UserAgentPolicy{Contains: []string{"bot"}, Action: "drop"}},
+		{"Invalid regex", UserAgentPolicy{Regex: []string{"("}, Action: UserAgentActionBypass}},
+		{"Empty substring", UserAgentPolicy{Contains: []string{""}, Action: UserAgentActionBypass}},
+		{"Invalid status code", UserAgentPolicy{Contains: []string{"bot"}, Action: UserAgentActionMinimal, StatusCode: 42}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				UserAgentPolicies:  []UserAgentPolicy{tc.policy},
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), nextHandler, cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
+
+// TestUserAgentMinimalRateLimited tests that minimal responses count against the rate limit
+func TestUserAgentMinimalRateLimited(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		UserAgentPolicies: []UserAgentPolicy{
+			{Contains: []string{"uptimerobot"}, Action: UserAgentActionMinimal},
+		},
+		Enabled:          true,
+		RateLimitAverage: 1,
+		RateLimitBurst:   2,
+	}
+
+	middleware, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+
+	for i, expected := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; UptimeRobot/2.0)")
+
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+
+		if recorder.Code != expected {
+			t.Errorf("Expected request %d to get status %d, got %d", i+1, expected, recorder.Code)
+		}
+	}
+}
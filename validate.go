@@ -0,0 +1,332 @@
+package traefik_maintenance_warden
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// minBypassValueLength is the length below which a bypass value is considered easy to guess
+const minBypassValueLength = 16
+
+// ConfigProblem is an error or a warning about a single configuration field
+type ConfigProblem struct {
+	// Field is the path of the field, e.g. "bypassPaths[1]"
+	Field string
+
+	// Message describes the problem
+	Message string
+}
+
+// String returns the problem prefixed with its field path
+func (p ConfigProblem) String() string {
+	if p.Field == "" {
+		return p.Message
+	}
+	return p.Field + ": " + p.Message
+}
+
+// ConfigError reports every problem found in a configuration at once
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+// Error lists the problems on a single line
+func (e *ConfigError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.String()
+	}
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(problems, "; "))
+}
+
+// configValidator collects the problems found while checking a configuration
+type configValidator struct {
+	errors   []ConfigProblem
+	warnings []ConfigProblem
+}
+
+// fail records an error about a field
+func (v *configValidator) fail(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, ConfigProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// warn records a warning about a field
+func (v *configValidator) warn(field, format string, args ...interface{}) {
+	v.warnings = append(v.warnings, ConfigProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// check records err, if any, as an error about a field
+func (v *configValidator) check(field string, err error) {
+	if err != nil {
+		v.fail(field, "%v", err)
+	}
+}
+
+// nonNegative records an error when a count or duration is negative
+func (v *configValidator) nonNegative(field string, value int) {
+	if value < 0 {
+		v.fail(field, "must not be negative, got %d", value)
+	}
+}
+
+// statusCode records an error when a maintenance status code isn't a client or server error
+func (v *configValidator) statusCode(field string, value int) {
+	if value != 0 && (value < 400 || value > 599) {
+		v.fail(field, "must be a 4xx or 5xx status code, got %d", value)
+	}
+}
+
+// compiledConfig holds the parts of a configuration compiled while validating it, so New
+// doesn't compile them a second time
+type compiledConfig struct {
+	statusCode         int
+	contentType        string
+	trafficKey         trafficKey
+	webSocketPolicy    string
+	ssePolicy          string
+	rules              []compiledRule
+	userAgentPolicies  []compiledUserAgentPolicy
+	maintenancePaths   []compiledMaintenancePath
+	apiPaths           []pathMatcher
+	maintenanceEndTime time.Time
+	maintenanceService *url.URL
+	redirectURL        *url.URL
+	redirectStatusCode int
+	defaultPage        *defaultPage
+	redisState         *redisState
+	consulState        *consulState
+	webhooks           *webhookDispatcher
+}
+
+// Validate checks the configuration without touching the network, the file system or the
+// environment, returning every error at once along with warnings about risky setups. New refuses
+// configurations with errors and logs the warnings. It then reads the files and environment
+// variables the configuration references, so it can still fail after Validate passes: those
+// problems are reported together in a second ConfigError.
+func (c *Config) Validate() ([]ConfigProblem, error) {
+	_, warnings, err := c.compile()
+	return warnings, err
+}
+
+// compile validates the configuration like Validate, returning its compiled parts when it is valid
+func (c *Config) compile() (*compiledConfig, []ConfigProblem, error) {
+	v := &configValidator{}
+	cc := &compiledConfig{statusCode: c.StatusCode, contentType: c.ContentType}
+
+	// Default to 503 Service Unavailable and HTML when not specified
+	if cc.statusCode == 0 {
+		cc.statusCode = http.StatusServiceUnavailable
+	}
+	if cc.contentType == "" {
+		cc.contentType = "text/html; charset=utf-8"
+	}
+
+	var err error
+	cc.maintenanceEndTime, err = parseMaintenanceEndTime(c.MaintenanceEndTime)
+	v.check("maintenanceEndTime", err)
+
+	c.validateContentSources(v, cc)
+	c.validateBypass(v)
+
+	v.statusCode("statusCode", c.StatusCode)
+	v.statusCode("streamStatusCode", c.StreamStatusCode)
+	v.nonNegative("maintenanceTimeout", c.MaintenanceTimeout)
+	if c.LogLevel < int(LogLevelNone) || c.LogLevel > int(LogLevelDebug) {
+		v.fail("logLevel", "must be between 0 and 3, got %d", c.LogLevel)
+	}
+
+	if c.TrafficPercentage < 0 || c.TrafficPercentage > 100 {
+		v.fail("trafficPercentage", "must be between 1 and 100, got %d", c.TrafficPercentage)
+	}
+	cc.trafficKey, err = parseTrafficKey(c.TrafficKey)
+	v.check("trafficKey", err)
+
+	v.nonNegative("drainGracePeriod", c.DrainGracePeriod)
+	if c.DrainMode && len(c.DrainSessionCookies) == 0 {
+		v.fail("drainSessionCookies", "drain mode requires at least one session cookie name")
+	}
+	if c.DrainMode && c.DrainSecret == "" && (c.MaintenanceGroup != "" || c.RedisState.Address != "" || c.ConsulState.Address != "") {
+		v.fail("drainSecret", "must be set when the maintenance state is shared, so every instance accepts the drain markers")
+	}
+	if c.DrainStartTime != "" {
+		if _, err := time.Parse(time.RFC3339, c.DrainStartTime); err != nil {
+			v.fail("drainStartTime", "must be an RFC3339 time, got %q", c.DrainStartTime)
+		}
+	}
+
+	cc.webSocketPolicy, err = validateStreamPolicy(c.WebSocketPolicy, false)
+	v.check("webSocketPolicy", err)
+	cc.ssePolicy, err = validateStreamPolicy(c.SSEPolicy, true)
+	v.check("ssePolicy", err)
+
+	v.nonNegative("rateLimitAverage", c.RateLimitAverage)
+	v.nonNegative("rateLimitBurst", c.RateLimitBurst)
+	v.nonNegative("rateLimitGlobalAverage", c.RateLimitGlobalAverage)
+	v.nonNegative("rateLimitGlobalBurst", c.RateLimitGlobalBurst)
+	v.nonNegative("rateLimitMaxClients", c.RateLimitMaxClients)
+
+	cc.rules = compileRules(v, c.Rules, cc.statusCode, cc.contentType)
+	cc.userAgentPolicies = compileUserAgentPolicies(v, c.UserAgentPolicies, cc.statusCode)
+	cc.maintenancePaths = compileMaintenancePaths(v, c.MaintenancePaths, cc.statusCode, cc.contentType)
+	for i, pattern := range c.APIPaths {
+		pm, err := compilePathPattern(pattern)
+		v.check(fmt.Sprintf("apiPaths[%d]", i), err)
+		cc.apiPaths = append(cc.apiPaths, pm)
+	}
+
+	v.check("cors", c.CORS.validate())
+	c.validateState(v, cc)
+
+	if c.RequestIDHeader != "" && !isHeaderName(c.RequestIDHeader) {
+		v.fail("requestIDHeader", "invalid header name %q", c.RequestIDHeader)
+	}
+	for name := range c.ResponseHeaders {
+		if !isHeaderName(name) {
+			v.fail("responseHeaders", "invalid header name %q", name)
+		}
+	}
+
+	if len(v.errors) > 0 {
+		return nil, v.warnings, &ConfigError{Problems: v.errors}
+	}
+	return cc, v.warnings, nil
+}
+
+// validateContentSources checks that at most one content source is set and that it is usable
+func (c *Config) validateContentSources(v *configValidator, cc *compiledConfig) {
+	var sources []string
+	if c.MaintenanceService != "" {
+		sources = append(sources, "maintenanceService")
+		if u, err := url.Parse(c.MaintenanceService); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			v.fail("maintenanceService", "must be an http or https URL, got %q", c.MaintenanceService)
+		} else {
+			cc.maintenanceService = u
+			if u.Scheme == "http" && c.ProxyForwardCredentials {
+				v.warn("proxyForwardCredentials", "cookies and credentials are forwarded to %s unencrypted", c.MaintenanceService)
+			}
+		}
+	}
+	if c.MaintenanceFilePath != "" {
+		sources = append(sources, "maintenanceFilePath")
+	}
+	if c.MaintenanceContent != "" {
+		sources = append(sources, "maintenanceContent")
+	}
+
+	v.nonNegative("maintenanceFileMaxSize", c.MaintenanceFileMaxSize)
+	maxSize := c.MaintenanceFileMaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaintenanceFileMaxSize
+	}
+	if len(c.MaintenanceContent) > maxSize {
+		v.fail("maintenanceContent", "is %d bytes, larger than the %d bytes limit", len(c.MaintenanceContent), maxSize)
+	}
+	if c.MaintenanceFileBaseDir != "" && c.MaintenanceFilePath == "" {
+		v.warn("maintenanceFileBaseDir", "has no effect without maintenanceFilePath")
+	}
+	if c.RedirectURL != "" {
+		sources = append(sources, "redirectURL")
+		var err error
+		cc.redirectURL, cc.redirectStatusCode, err = validateRedirect(c.RedirectURL, c.RedirectStatusCode)
+		v.check("redirectURL", err)
+	}
+
+	if len(sources) > 1 {
+		v.fail(strings.Join(sources, ", "), "only one content source may be set")
+	}
+	if len(sources) == 0 {
+		var err error
+		cc.defaultPage, err = newDefaultPage(c.DefaultPage, cc.maintenanceEndTime)
+		v.check("defaultPage", err)
+	}
+}
+
+// validateBypass checks the bypass mechanisms and warns about values that are easy to guess
+func (c *Config) validateBypass(v *configValidator) {
+	if c.BypassHeader == "" && (c.BypassHeaderValue != "" || len(c.BypassHeaderValues) > 0) {
+		v.fail("bypassHeader", "must be set when bypass header values are configured")
+	}
+	if c.BypassHeader != "" && !isHeaderName(c.BypassHeader) {
+		v.fail("bypassHeader", "invalid header name %q", c.BypassHeader)
+	}
+
+	if c.BypassHeaderValue != "" && len(c.BypassHeaderValue) < minBypassValueLength {
+		v.warn("bypassHeaderValue", "value is short and easy to guess, use a long random value")
+	}
+	for i, value := range c.BypassHeaderValues {
+		field := fmt.Sprintf("bypassHeaderValues[%d]", i)
+		sources := 0
+		for _, source := range []string{value.Value, value.ValueFile, value.ValueEnv} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			v.fail(field, "exactly one of value, valueFile or valueEnv must be set")
+		} else if value.Value != "" && len(value.Value) < minBypassValueLength {
+			v.warn(field+".value", "value is short and easy to guess, use a long random value")
+		}
+	}
+
+	for i, path := range c.BypassPaths {
+		field := fmt.Sprintf("bypassPaths[%d]", i)
+		if !strings.HasPrefix(path, "/") {
+			v.fail(field, "must be an absolute path starting with /, got %q", path)
+		} else if path == "/" {
+			v.warn(field, "bypasses maintenance for every request")
+		}
+	}
+
+	if c.BypassQueryParam != "" && c.BypassHeaderValue == "" && len(c.BypassHeaderValues) == 0 {
+		v.fail("bypassQueryParam", "requires bypassHeaderValue or bypassHeaderValues")
+	}
+	v.nonNegative("bypassCookieMaxAge", c.BypassCookieMaxAge)
+	v.nonNegative("bypassMaxFailures", c.BypassMaxFailures)
+	v.nonNegative("bypassFailureWindow", c.BypassFailureWindow)
+	v.nonNegative("bypassBanDuration", c.BypassBanDuration)
+	v.nonNegative("bypassBanMaxClients", c.BypassBanMaxClients)
+
+	if c.BasicAuthBypass.LoginPath != "" && c.BasicAuthBypass.HtpasswdFile == "" {
+		v.fail("basicAuthBypass.loginPath", "requires an htpasswdFile")
+	}
+
+	if c.JWTBypass.configured() {
+		if c.JWTBypass.RequiredClaim == "" || c.JWTBypass.RequiredValue == "" {
+			v.fail("jwtBypass.requiredClaim", "requiredClaim and requiredValue must be set")
+		}
+		for i, key := range c.JWTBypass.PublicKeys {
+			if _, err := parsePublicKeyPEM([]byte(key)); err != nil {
+				v.fail(fmt.Sprintf("jwtBypass.publicKeys[%d]", i), "%v", err)
+			}
+		}
+	}
+}
+
+// validateState checks the shared state sources and the webhooks
+func (c *Config) validateState(v *configValidator, cc *compiledConfig) {
+	if (c.MaintenanceGroup == "") != (c.StateFile == "") {
+		v.fail("maintenanceGroup", "maintenanceGroup and stateFile must be set together")
+	}
+
+	var err error
+	if c.RedisState.Address != "" {
+		cc.redisState, err = newRedisState(c.RedisState)
+		v.check("redisState", err)
+	}
+	if c.ConsulState.Address != "" {
+		cc.consulState, err = newConsulState(c.ConsulState)
+		v.check("consulState", err)
+	}
+	if len(c.Webhooks) > 0 {
+		cc.webhooks, err = newWebhookDispatcher(c.Webhooks)
+		v.check("webhooks", err)
+		if !c.NotifyWebhooks {
+			v.warn("webhooks", "no notification is sent unless notifyWebhooks is set")
+		}
+	} else if c.NotifyWebhooks {
+		v.fail("notifyWebhooks", "requires webhooks")
+	}
+}
@@ -0,0 +1,299 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidateReportsEveryProblem tests that all problems are reported at once with their field paths
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent:  "<html><body>Maintenance</body></html>",
+		MaintenanceFilePath: "/var/www/maintenance.html",
+		BypassHeaderValue:   "a-long-random-bypass-value",
+		BypassPaths:         []string{"/health", "api/status"},
+		StatusCode:          200,
+		StreamStatusCode:    999,
+		MaintenanceTimeout:  -5,
+		BypassBanDuration:   -1,
+		LogLevel:            7,
+		TrafficPercentage:   150,
+		SSEPolicy:           "drop",
+		MaintenanceGroup:    "shop",
+		ResponseHeaders:     map[string]string{"X Robots": "noindex"},
+		JWTBypass:           JWTBypassConfig{PublicKeys: []string{"not a PEM key"}},
+	}
+
+	_, err := cfg.Validate()
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected a ConfigError, got %v", err)
+	}
+
+	expectedFields := []string{
+		"maintenanceFilePath, maintenanceContent",
+		"bypassHeader",
+		"bypassPaths[1]",
+		"statusCode",
+		"streamStatusCode",
+		"maintenanceTimeout",
+		"bypassBanDuration",
+		"logLevel",
+		"trafficPercentage",
+		"ssePolicy",
+		"maintenanceGroup",
+		"responseHeaders",
+		"jwtBypass.requiredClaim",
+		"jwtBypass.publicKeys[0]",
+	}
+
+	fields := map[string]bool{}
+	for _, problem := range configErr.Problems {
+		fields[problem.Field] = true
+	}
+	for _, field := range expectedFields {
+		if !fields[field] {
+			t.Errorf("Expected a problem for %s, got %v", field, configErr.Problems)
+		}
+	}
+	if len(configErr.Problems) != len(expectedFields) {
+		t.Errorf("Expected %d problems, got %d: %v", len(expectedFields), len(configErr.Problems), configErr.Problems)
+	}
+
+	if !strings.Contains(err.Error(), "bypassPaths[1]: must be an absolute path") {
+		t.Errorf("Expected the error message to include field paths, got %q", err.Error())
+	}
+}
+
+// TestValidateReportsEveryItem tests that every broken rule, policy and section is reported with its index
+func TestValidateReportsEveryItem(t *testing.T) {
+	cfg := &Config{
+		Rules: []Rule{
+			{Action: "drop"},
+			{Action: RuleActionRedirect, StatusCode: 200},
+			{Match: RuleMatcher{IPs: []string{"not-an-ip"}}, Action: RuleActionBlock},
+		},
+		UserAgentPolicies: []UserAgentPolicy{
+			{Regex: []string{"(unclosed"}, Action: UserAgentActionPage},
+			{Contains: []string{"bot"}, Action: "ignore"},
+		},
+		MaintenancePaths: []MaintenancePath{
+			{Path: ""},
+			{Path: "/shop", StatusCode: 200},
+		},
+	}
+
+	_, err := cfg.Validate()
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected a ConfigError, got %v", err)
+	}
+
+	expectedFields := []string{
+		"rules[0].action",
+		"rules[1].redirectURL",
+		"rules[1].statusCode",
+		"rules[2].match",
+		"userAgentPolicies[0].regex[0]",
+		"userAgentPolicies[1].action",
+		"maintenancePaths[0].path",
+		"maintenancePaths[1].statusCode",
+	}
+
+	if len(configErr.Problems) != len(expectedFields) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expectedFields), len(configErr.Problems), configErr.Problems)
+	}
+	for i, field := range expectedFields {
+		if configErr.Problems[i].Field != field {
+			t.Errorf("Expected problem %d about %s, got %s", i, field, configErr.Problems[i])
+		}
+	}
+}
+
+// TestNewReportsEveryFileProblem tests that files and environment variables Validate doesn't read
+// are reported at once by New
+func TestNewReportsEveryFileProblem(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-validate")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	missing := func(name string) string {
+		return filepath.Join(tmpDir, name)
+	}
+
+	cfg := &Config{
+		MaintenanceFilePath: missing("maintenance.html"),
+		BypassHeader:        "X-Maintenance-Bypass",
+		BypassHeaderValues: []BypassValue{
+			{Label: "ops", ValueFile: missing("ops-secret")},
+			{Label: "qa", ValueEnv: "MAINTENANCE_TEST_UNSET_BYPASS_VALUE"},
+		},
+		JWTBypass: JWTBypassConfig{
+			SecretFile:    missing("jwt-secret"),
+			RequiredClaim: "roles",
+			RequiredValue: "maintenance-bypass",
+		},
+		BasicAuthBypass: BasicAuthConfig{HtpasswdFile: missing("htpasswd")},
+		Enabled:         true,
+	}
+
+	if _, err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected Validate not to read files, got %v", err)
+	}
+
+	_, err = New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected a ConfigError, got %v", err)
+	}
+
+	expectedFields := []string{
+		"bypassHeaderValues[0].valueFile",
+		"bypassHeaderValues[1].valueEnv",
+		"jwtBypass",
+		"basicAuthBypass.htpasswdFile",
+		"maintenanceFilePath",
+	}
+	if len(configErr.Problems) != len(expectedFields) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expectedFields), len(configErr.Problems), configErr.Problems)
+	}
+	for i, field := range expectedFields {
+		if configErr.Problems[i].Field != field {
+			t.Errorf("Expected problem %d about %s, got %s", i, field, configErr.Problems[i])
+		}
+	}
+}
+
+// TestValidateStatusCodes tests that section and content rule status codes must be errors
+func TestValidateStatusCodes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        *Config
+		expectedField string
+	}{
+		{
+			"Section served with 200",
+			&Config{MaintenancePaths: []MaintenancePath{{Path: "/shop"}, {Path: "/checkout", StatusCode: 200}}},
+			"maintenancePaths[1].statusCode",
+		},
+		{
+			"Content rule served with 200",
+			&Config{Rules: []Rule{{Action: RuleActionContent, Content: "Maintenance", StatusCode: 200}}},
+			"rules[0].statusCode",
+		},
+		{
+			"Redirect rule status code is checked by the rules",
+			&Config{Rules: []Rule{{Action: RuleActionRedirect, RedirectURL: "https://status.example.com", StatusCode: 301}}},
+			"",
+		},
+		{
+			"Section with an error status code",
+			&Config{MaintenancePaths: []MaintenancePath{{Path: "/shop", StatusCode: 501}}},
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.config.Validate()
+
+			if tc.expectedField == "" {
+				if err != nil {
+					t.Errorf("Expected no error but got: %v", err)
+				}
+				return
+			}
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || len(configErr.Problems) != 1 || configErr.Problems[0].Field != tc.expectedField {
+				t.Errorf("Expected a single problem for %s, got %v", tc.expectedField, err)
+			}
+		})
+	}
+}
+
+// TestValidateWarnings tests warnings about risky but valid setups
+func TestValidateWarnings(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         *Config
+		expectedFields []string
+	}{
+		{"Default configuration", CreateConfig(), []string{"bypassHeaderValue"}},
+		{
+			"Strong values",
+			&Config{
+				BypassHeader:       "X-Maintenance-Bypass",
+				BypassHeaderValue:  "3f9b1c7e2d8a4f60",
+				BypassHeaderValues: []BypassValue{{Label: "ops", ValueEnv: "OPS_BYPASS"}},
+			},
+			nil,
+		},
+		{
+			"Short labelled value and root bypass path",
+			&Config{
+				BypassHeader:       "X-Maintenance-Bypass",
+				BypassHeaderValues: []BypassValue{{Label: "qa", Value: "qa"}},
+				BypassPaths:        []string{"/"},
+			},
+			[]string{"bypassHeaderValues[0].value", "bypassPaths[0]"},
+		},
+		{
+			"Credentials forwarded over plain HTTP",
+			&Config{MaintenanceService: "http://maintenance.internal", ProxyForwardCredentials: true},
+			[]string{"proxyForwardCredentials"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := tc.config.Validate()
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+
+			if len(warnings) != len(tc.expectedFields) {
+				t.Fatalf("Expected %d warnings, got %v", len(tc.expectedFields), warnings)
+			}
+			for i, field := range tc.expectedFields {
+				if warnings[i].Field != field {
+					t.Errorf("Expected warning about %s, got %s", field, warnings[i])
+				}
+			}
+		})
+	}
+}
+
+// TestNewUsesValidate tests that New rejects invalid configurations with every problem and logs warnings
+func TestNewUsesValidate(t *testing.T) {
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		BypassHeaderValue:  "true",
+		StatusCode:         999,
+		Enabled:            true,
+	}
+
+	_, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test")
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 {
+		t.Fatalf("Expected the bypassHeader and statusCode problems, got %v", err)
+	}
+
+	cfg.BypassHeader = "X-Maintenance-Bypass"
+	cfg.StatusCode = 0
+	if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err != nil {
+		t.Errorf("Expected warnings not to prevent creating the middleware, got %v", err)
+	}
+}
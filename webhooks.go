@@ -0,0 +1,276 @@
+package traefik_maintenance_warden
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Webhook events sent when the maintenance state changes
+const (
+	// WebhookEventStarted is sent when maintenance mode is switched on
+	WebhookEventStarted = "maintenance.started"
+	// WebhookEventEnded is sent when maintenance mode is switched off
+	WebhookEventEnded = "maintenance.ended"
+)
+
+// configuredStates remembers the Enabled setting of the last instance created for each middleware
+// name. Traefik rebuilds middlewares on every dynamic configuration change, so this is how a reload
+// switching maintenance on or off is told apart from a middleware starting up.
+var (
+	configuredStates      = map[string]bool{}
+	configuredStatesMutex sync.Mutex
+)
+
+// swapConfiguredState records the configured state of the named middleware, returning the state
+// configured before and whether there was one
+func swapConfiguredState(name string, enabled bool) (bool, bool) {
+	configuredStatesMutex.Lock()
+	defer configuredStatesMutex.Unlock()
+
+	previous, ok := configuredStates[name]
+	configuredStates[name] = enabled
+	return previous, ok
+}
+
+// WebhookConfig is an outbound notification sent when maintenance starts or ends
+type WebhookConfig struct {
+	// URL receives the notification
+	URL string `json:"url,omitempty"`
+
+	// Method is the HTTP method of the notification. Defaults to POST.
+	Method string `json:"method,omitempty"`
+
+	// Body is a text/template rendered with the WebhookEvent. The "json" function encodes a value
+	// as JSON, e.g. {"text": {{json .Event}}}. Defaults to the event encoded as JSON.
+	Body string `json:"body,omitempty"`
+
+	// Headers are added to the notification
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Secret signs the notification: X-Maintenance-Signature holds "sha256=" and the hex HMAC-SHA256
+	// of the X-Maintenance-Timestamp value, a dot and the body
+	Secret string `json:"secret,omitempty"`
+
+	// MaxRetries is how many times a failed delivery is retried with exponential backoff. Defaults to 3.
+	MaxRetries int `json:"maxRetries,omitempty"`
+}
+
+// WebhookEvent is the data available to webhook body templates
+type WebhookEvent struct {
+	Event      string    `json:"event"`
+	Enabled    bool      `json:"enabled"`
+	Middleware string    `json:"middleware"`
+	Source     string    `json:"source"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// webhook is a validated webhook ready to deliver notifications
+type webhook struct {
+	url        string
+	method     string
+	body       *template.Template
+	headers    map[string]string
+	secret     []byte
+	maxRetries int
+}
+
+// webhookDelivery is a notification waiting in the queue
+type webhookDelivery struct {
+	hook  *webhook
+	event WebhookEvent
+}
+
+// webhookDispatcher delivers notifications from a bounded background queue so state changes
+// never wait for slow receivers
+type webhookDispatcher struct {
+	hooks      []*webhook
+	queue      chan webhookDelivery
+	client     *http.Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// newWebhookDispatcher validates the webhooks and applies the defaults
+func newWebhookDispatcher(configs []WebhookConfig) (*webhookDispatcher, error) {
+	hooks := make([]*webhook, 0, len(configs))
+
+	for i, config := range configs {
+		target, err := url.Parse(config.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("webhook %d: url must be an http or https URL, got %q", i, config.URL)
+		}
+
+		method := config.Method
+		if method == "" {
+			method = http.MethodPost
+		}
+
+		body := config.Body
+		if body == "" {
+			body = "{{json .}}"
+		}
+		tmpl, err := template.New(fmt.Sprintf("webhook-%d", i)).Funcs(template.FuncMap{"json": templateJSON}).Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d: invalid body template: %w", i, err)
+		}
+
+		if config.MaxRetries < 0 {
+			return nil, fmt.Errorf("webhook %d: max retries must not be negative", i)
+		}
+		maxRetries := config.MaxRetries
+		if maxRetries == 0 {
+			maxRetries = 3
+		}
+
+		hooks = append(hooks, &webhook{
+			url:        config.URL,
+			method:     method,
+			body:       tmpl,
+			headers:    config.Headers,
+			secret:     []byte(config.Secret),
+			maxRetries: maxRetries,
+		})
+	}
+
+	return &webhookDispatcher{
+		hooks:      hooks,
+		queue:      make(chan webhookDelivery, 100),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+	}, nil
+}
+
+// templateJSON encodes a value as JSON for use in body templates
+func templateJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+// signWebhook returns the signature of a notification sent at timestamp
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// run delivers queued notifications until the context is cancelled
+func (d *webhookDispatcher) run(ctx context.Context, m *MaintenanceBypass) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-d.queue:
+			d.deliver(ctx, m, delivery)
+		}
+	}
+}
+
+// deliver sends a notification, retrying failures with exponential backoff
+func (d *webhookDispatcher) deliver(ctx context.Context, m *MaintenanceBypass, delivery webhookDelivery) {
+	var body bytes.Buffer
+	if err := delivery.hook.body.Execute(&body, delivery.event); err != nil {
+		m.log(LogLevelError, "Failed to render %s webhook for %s: %v", delivery.event.Event, delivery.hook.url, err)
+		return
+	}
+
+	backoff := d.minBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := d.send(ctx, delivery.hook, body.Bytes())
+		if err == nil {
+			m.log(LogLevelDebug, "Delivered %s webhook to %s", delivery.event.Event, delivery.hook.url)
+			return
+		}
+		if !retry || attempt >= delivery.hook.maxRetries {
+			m.log(LogLevelError, "Failed to deliver %s webhook to %s after %d attempts: %v",
+				delivery.event.Event, delivery.hook.url, attempt+1, err)
+			return
+		}
+
+		m.log(LogLevelDebug, "Webhook delivery to %s failed, retrying in %v: %v", delivery.hook.url, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// send makes a single delivery attempt, reporting whether a failure is worth retrying
+func (d *webhookDispatcher) send(ctx context.Context, hook *webhook, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, hook.method, hook.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.headers {
+		req.Header.Set(name, value)
+	}
+	if len(hook.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Maintenance-Timestamp", timestamp)
+		req.Header.Set("X-Maintenance-Signature", signWebhook(hook.secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	// Client errors won't go away by retrying, except for rate limiting
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// notifyStateChange queues a notification for every webhook without blocking.
+// Notifications are dropped with an error when the queue is full.
+func (m *MaintenanceBypass) notifyStateChange(enabled bool, source string) {
+	if m.webhooks == nil {
+		return
+	}
+
+	event := WebhookEvent{
+		Event:      WebhookEventEnded,
+		Enabled:    enabled,
+		Middleware: m.name,
+		Source:     source,
+		Timestamp:  time.Now().UTC(),
+	}
+	if enabled {
+		event.Event = WebhookEventStarted
+	}
+
+	for _, hook := range m.webhooks.hooks {
+		select {
+		case m.webhooks.queue <- webhookDelivery{hook: hook, event: event}:
+		default:
+			m.log(LogLevelError, "Webhook queue is full, dropping %s notification to %s", event.Event, hook.url)
+		}
+	}
+}
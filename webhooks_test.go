@@ -0,0 +1,311 @@
+package traefik_maintenance_warden
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWebhookReceiver records notifications, failing the first attempts with the given status
+type testWebhookReceiver struct {
+	mutex      sync.Mutex
+	failures   int
+	failStatus int
+	attempts   int
+	requests   []*http.Request
+	bodies     []string
+}
+
+func (r *testWebhookReceiver) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.attempts++
+	if r.attempts <= r.failures {
+		rw.WriteHeader(r.failStatus)
+		return
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+}
+
+// waitForDeliveries waits until the receiver got the expected number of notifications
+func (r *testWebhookReceiver) waitForDeliveries(t *testing.T, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mutex.Lock()
+		delivered := len(r.bodies)
+		r.mutex.Unlock()
+		if delivered >= expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d deliveries, got %d", expected, delivered)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestWebhooks tests signed notifications rendered from the body template
+func TestWebhooks(t *testing.T) {
+	receiver := &testWebhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{
+		MaintenanceContent: "<html><body>Maintenance</body></html>",
+		Webhooks: []WebhookConfig{
+			{
+				URL:     server.URL + "/slack",
+				Method:  http.MethodPut,
+				Body:    `{"text": {{json (printf "%s: %s (%s)" .Middleware .Event .Source)}}}`,
+				Headers: map[string]string{"X-Team": "platform"},
+				Secret:  "webhook-secret",
+			},
+		},
+		NotifyWebhooks: true,
+		Enabled:        false,
+	}
+
+	middleware, err := New(ctx, http.NotFoundHandler(), cfg, "shop")
+	if err != nil {
+		t.Fatalf("Error creating middleware: %v", err)
+	}
+	m := middleware.(*MaintenanceBypass)
+
+	if err := m.SetEnabled(true); err != nil {
+		t.Fatalf("Error enabling maintenance: %v", err)
+	}
+	// Setting the same state again is not a change
+	m.SetEnabled(true)
+	m.SetEnabled(false)
+
+	receiver.waitForDeliveries(t, 2)
+	time.Sleep(50 * time.Millisecond)
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	if len(receiver.bodies) != 2 {
+		t.Fatalf("Expected 2 notifications, got %d", len(receiver.bodies))
+	}
+
+	expectedBodies := []string{
+		`{"text": "shop: maintenance.started (shop)"}`,
+		`{"text": "shop: maintenance.ended (shop)"}`,
+	}
+	for i, req := range receiver.requests {
+		if receiver.bodies[i] != expectedBodies[i] {
+			t.Errorf("Expected body %q, got %q", expectedBodies[i], receiver.bodies[i])
+		}
+		if req.Method != http.MethodPut || req.URL.Path != "/slack" || req.Header.Get("X-Team") != "platform" {
+			t.Errorf("Expected PUT /slack with custom header, got %s %s %v", req.Method, req.URL.Path, req.Header)
+		}
+
+		expectedSignature := signWebhook([]byte("webhook-secret"), req.Header.Get("X-Maintenance-Timestamp"), []byte(receiver.bodies[i]))
+		if req.Header.Get("X-Maintenance-Timestamp") == "" || req.Header.Get("X-Maintenance-Signature") != expectedSignature {
+			t.Errorf("Expected signature %q, got %q", expectedSignature, req.Header.Get("X-Maintenance-Signature"))
+		}
+	}
+}
+
+// TestWebhooksStateChanges tests notifying changes made outside SetEnabled: a state file written
+// by hand and a configuration reload switching Enabled
+func TestWebhooksStateChanges(t *testing.T) {
+	receiver := &testWebhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "maintenance-test-webhooks")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	stateFilePath := filepath.Join(tmpDir, "state.json")
+	if err := ioutil.WriteFile(stateFilePath, []byte(`{"groups":{"shop":{"enabled":true}}}`), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	// Forget instances created by earlier runs of this test
+	configuredStatesMutex.Lock()
+	delete(configuredStates, "webhooks-shop")
+	delete(configuredStates, "webhooks-blog")
+	configuredStatesMutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newInstance := func(name string, enabled bool, group string) *MaintenanceBypass {
+		cfg := &Config{
+			MaintenanceContent: "<html><body>Maintenance</body></html>",
+			Webhooks:           []WebhookConfig{{URL: server.URL, Body: "{{.Middleware}} {{.Event}} ({{.Source}})"}},
+			NotifyWebhooks:     true,
+			Enabled:            enabled,
+		}
+		if group != "" {
+			cfg.MaintenanceGroup = group
+			cfg.StateFile = stateFilePath
+		}
+
+		middleware, err := New(ctx, http.NotFoundHandler(), cfg, name)
+		if err != nil {
+			t.Fatalf("Error creating middleware: %v", err)
+		}
+		return middleware.(*MaintenanceBypass)
+	}
+
+	// The state file read at startup isn't a change, a later write is
+	shop := newInstance("webhooks-shop", false, "shop")
+	shop.stateFile.refreshInterval = 0
+	if err := ioutil.WriteFile(stateFilePath, []byte(`{"groups":{"shop":{"enabled":false}}}`), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	shop.isEnabled()
+	receiver.waitForDeliveries(t, 1)
+
+	// A reload switching Enabled is a change, one keeping it or a first start is not
+	newInstance("webhooks-blog", false, "")
+	newInstance("webhooks-blog", false, "")
+	newInstance("webhooks-blog", true, "")
+	receiver.waitForDeliveries(t, 2)
+	time.Sleep(50 * time.Millisecond)
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	expectedBodies := []string{
+		`webhooks-shop maintenance.ended (maintenance group "shop")`,
+		"webhooks-blog maintenance.started (configuration)",
+	}
+	if len(receiver.bodies) != len(expectedBodies) || receiver.bodies[0] != expectedBodies[0] || receiver.bodies[1] != expectedBodies[1] {
+		t.Errorf("Expected notifications %q, got %q", expectedBodies, receiver.bodies)
+	}
+}
+
+// TestWebhookRetries tests retrying failed deliveries and giving up on client errors
+func TestWebhookRetries(t *testing.T) {
+	testCases := []struct {
+		name             string
+		failures         int
+		failStatus       int
+		expectedAttempts int
+		expectedLog      string
+	}{
+		{"Server errors are retried", 2, http.StatusBadGateway, 3, "Delivered maintenance.started webhook"},
+		{"Retries are limited", 10, http.StatusServiceUnavailable, 4, "after 4 attempts"},
+		{"Client errors are not retried", 10, http.StatusUnauthorized, 1, "after 1 attempts"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			receiver := &testWebhookReceiver{failures: tc.failures, failStatus: tc.failStatus}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+
+			dispatcher, err := newWebhookDispatcher([]WebhookConfig{{URL: server.URL}})
+			if err != nil {
+				t.Fatalf("Error creating dispatcher: %v", err)
+			}
+			dispatcher.minBackoff = time.Millisecond
+
+			logBuffer := &testLogWriter{}
+			m := &MaintenanceBypass{name: "shop", logLevel: LogLevelDebug, webhooks: dispatcher}
+			m.logger = log.New(logBuffer, "", 0)
+
+			m.notifyStateChange(true, "test")
+			dispatcher.deliver(context.Background(), m, <-dispatcher.queue)
+
+			if receiver.attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, receiver.attempts)
+			}
+			if !strings.Contains(logBuffer.String(), tc.expectedLog) {
+				t.Errorf("Expected log to contain %q, got %q", tc.expectedLog, logBuffer.String())
+			}
+		})
+	}
+}
+
+// TestWebhookQueueNeverBlocks tests that notifications are dropped rather than blocking when the queue is full
+func TestWebhookQueueNeverBlocks(t *testing.T) {
+	dispatcher, err := newWebhookDispatcher([]WebhookConfig{{URL: "http://127.0.0.1:1/hook"}})
+	if err != nil {
+		t.Fatalf("Error creating dispatcher: %v", err)
+	}
+
+	logBuffer := &testLogWriter{}
+	m := &MaintenanceBypass{name: "shop", logLevel: LogLevelError, webhooks: dispatcher}
+	m.logger = log.New(logBuffer, "", 0)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(dispatcher.queue)+5; i++ {
+			m.notifyStateChange(i%2 == 0, "test")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected notifications not to block")
+	}
+
+	if !strings.Contains(logBuffer.String(), "Webhook queue is full") {
+		t.Errorf("Expected dropped notifications to be logged, got %q", logBuffer.String())
+	}
+}
+
+// TestWebhooksValidation tests that misconfigured webhooks are rejected
+func TestWebhooksValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		webhook WebhookConfig
+	}{
+		{"Missing URL", WebhookConfig{}},
+		{"Unsupported scheme", WebhookConfig{URL: "ftp://example.com/hook"}},
+		{"Invalid template", WebhookConfig{URL: "https://example.com/hook", Body: "{{.Event"}},
+		{"Negative retries", WebhookConfig{URL: "https://example.com/hook", MaxRetries: -1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				MaintenanceContent: "<html><body>Maintenance</body></html>",
+				Webhooks:           []WebhookConfig{tc.webhook},
+				Enabled:            true,
+			}
+
+			if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+
+	t.Run("Notifying without webhooks", func(t *testing.T) {
+		cfg := &Config{
+			MaintenanceContent: "<html><body>Maintenance</body></html>",
+			NotifyWebhooks:     true,
+			Enabled:            true,
+		}
+
+		if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "maintenance-test"); err == nil {
+			t.Errorf("Expected error but got none")
+		}
+	})
+}